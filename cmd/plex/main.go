@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net"
 	"os"
@@ -11,7 +12,10 @@ import (
 	"github.com/kjbreil/go-plex/pkg/plex"
 )
 
-const webhookPort = 8081
+const (
+	webhookPort     = 8081
+	refreshInterval = 15 * time.Minute
+)
 
 func main() {
 	plexHost := os.Getenv("PLEX_HOST")
@@ -34,16 +38,28 @@ func main() {
 
 	go func() {
 		start := time.Now()
-		conn.PopulateLibraries()()
+		if populateErr := conn.PopulateLibraries()(); populateErr != nil {
+			logger.Error("plex library refresh failed", "err", populateErr.Error())
+			return
+		}
 		logger.Info("plex library refreshed", "duration", time.Since(start))
 	}()
 
+	// refresh the changes every 15 minutes and everything every 6 hours, Close stops the refresh
+	err = conn.StartAutoRefresh(context.Background(), refreshInterval, plex.AutoRefreshOptions{
+		Jitter:    time.Minute,
+		FullEvery: 24,
+	})
+	if err != nil {
+		panic(err)
+	}
+
 	ctrlC := make(chan os.Signal, 1)
 	signal.Notify(ctrlC, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	go func() {
-		_ = setupWebhooks(conn)
-	}()
+	if err = setupWebhooks(conn); err != nil {
+		logger.Error("could not set up webhooks", "err", err.Error())
+	}
 
 	<-ctrlC
 
@@ -56,43 +72,37 @@ func setupWebhooks(conn *plex.Plex) error {
 
 	conn.Webhook = plex.NewWebhook(webhookPort, ip)
 
-	if err := conn.Webhook.OnPlay(func(w plex.WebhookEvent) {
+	conn.Webhook.OnPlay(func(w plex.WebhookEvent) {
 		logger.Info("media playing", "title", w.Metadata.Title)
-	}); err != nil {
-		return err
-	}
+	})
 
-	if err := conn.Webhook.OnPause(func(w plex.WebhookEvent) {
+	conn.Webhook.OnPause(func(w plex.WebhookEvent) {
 		logger.Info("media paused", "title", w.Metadata.Title)
-	}); err != nil {
-		return err
-	}
+	})
 
-	if err := conn.Webhook.OnResume(func(w plex.WebhookEvent) {
+	conn.Webhook.OnResume(func(w plex.WebhookEvent) {
 		logger.Info("media resumed", "title", w.Metadata.Title)
-	}); err != nil {
-		return err
-	}
+	})
 
-	if err := conn.Webhook.OnStop(func(w plex.WebhookEvent) {
+	conn.Webhook.OnStop(func(w plex.WebhookEvent) {
 		logger.Info("media stopped", "title", w.Metadata.Title)
-	}); err != nil {
-		return err
-	}
+	})
 
-	if err := conn.Webhook.OnRate(func(w plex.WebhookEvent) {
+	conn.Webhook.OnRate(func(w plex.WebhookEvent) {
 		logger.Info("media rated", "title", w.Metadata.Title)
-	}); err != nil {
-		return err
-	}
+	})
 
-	if err := conn.Webhook.OnScrobble(func(w plex.WebhookEvent) {
+	conn.Webhook.OnScrobble(func(w plex.WebhookEvent) {
 		logger.Info("media scrobbled", "title", w.Metadata.Title)
-	}); err != nil {
-		return err
-	}
+	})
+
+	conn.Webhook.OnLibraryNew(func(w plex.WebhookEvent) {
+		logger.Info("media added", "title", w.Metadata.Title, "library", w.Metadata.LibrarySectionTitle)
+	})
 
-	conn.ServeWebhook()
+	conn.Webhook.OnUnknown(func(w plex.WebhookEvent) {
+		logger.Info("unhandled webhook", "event", w.Event)
+	})
 
-	return nil
+	return conn.ServeWebhook()
 }
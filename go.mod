@@ -1,7 +1,13 @@
 module github.com/kjbreil/go-plex
 
-go 1.23
+go 1.23.0
 
 require nhooyr.io/websocket v1.8.17
 
-require github.com/coder/websocket v1.8.14 // indirect
+require (
+	github.com/coder/websocket v1.8.14
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/sync v0.16.0
+)
+
+require golang.org/x/sys v0.29.0 // indirect
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"strconv"
+	"strings"
 
 	"github.com/kjbreil/go-plex/pkg/library"
 )
@@ -14,6 +15,15 @@ type LibrarySections struct {
 	} `json:"MediaContainer"`
 }
 
+// Identity of a plex media server.
+type Identity struct {
+	MediaContainer struct {
+		Claimed           bool   `json:"claimed"`
+		MachineIdentifier string `json:"machineIdentifier"`
+		Version           string `json:"version"`
+	} `json:"MediaContainer"`
+}
+
 // SearchMediaContainer ...
 type SearchMediaContainer struct {
 	MediaContainer
@@ -45,6 +55,7 @@ type Metadata struct {
 	Player                Player       `json:"Player"`
 	Session               Session      `json:"Session"`
 	User                  User         `json:"User"`
+	TranscodeSession      *Transcode   `json:"TranscodeSession"`
 	AddedAt               int          `json:"addedAt"`
 	Art                   string       `json:"art"`
 	ContentRating         string       `json:"contentRating"`
@@ -87,6 +98,11 @@ type Metadata struct {
 	Year                  int          `json:"year"`
 	Director              []TaggedData `json:"Director"`
 	Writer                []TaggedData `json:"Writer"`
+	Role                  []TaggedData `json:"Role"`
+	Genre                 []TaggedData `json:"Genre"`
+	Studio                string       `json:"studio"`
+	Tagline               string       `json:"tagline"`
+	LastRatedAt           int          `json:"lastRatedAt"`
 }
 
 // User plex server user. only difference is id is a string.
@@ -150,6 +166,73 @@ type Session struct {
 	Location  string `json:"location"`
 }
 
+// Transcode is a transcoder session of the server, part of a playback session or listed on its own.
+type Transcode struct {
+	Key                     string  `json:"key"`
+	Throttled               bool    `json:"throttled"`
+	Complete                bool    `json:"complete"`
+	Progress                float64 `json:"progress"`
+	Size                    int64   `json:"size"`
+	Speed                   float64 `json:"speed"`
+	Error                   bool    `json:"error"`
+	Duration                int64   `json:"duration"`
+	Remaining               int64   `json:"remaining"`
+	Context                 string  `json:"context"`
+	SourceVideoCodec        string  `json:"sourceVideoCodec"`
+	SourceAudioCodec        string  `json:"sourceAudioCodec"`
+	VideoDecision           string  `json:"videoDecision"`
+	AudioDecision           string  `json:"audioDecision"`
+	SubtitleDecision        string  `json:"subtitleDecision"`
+	Protocol                string  `json:"protocol"`
+	Container               string  `json:"container"`
+	VideoCodec              string  `json:"videoCodec"`
+	AudioCodec              string  `json:"audioCodec"`
+	AudioChannels           int     `json:"audioChannels"`
+	TranscodeHwRequested    bool    `json:"transcodeHwRequested"`
+	TranscodeHwDecoding     string  `json:"transcodeHwDecoding"`
+	TranscodeHwEncoding     string  `json:"transcodeHwEncoding"`
+	TranscodeHwFullPipeline bool    `json:"transcodeHwFullPipeline"`
+	MaxOffsetAvailable      float64 `json:"maxOffsetAvailable"`
+	MinOffsetAvailable      float64 `json:"minOffsetAvailable"`
+}
+
+// TranscodeSessions are the running transcoder sessions of the server.
+type TranscodeSessions struct {
+	MediaContainer struct {
+		TranscodeSession []Transcode `json:"TranscodeSession"`
+		Size             int         `json:"size"`
+	} `json:"MediaContainer"`
+}
+
+// History is a page of the playback history of the server.
+type History struct {
+	MediaContainer struct {
+		Metadata  []HistoryItem `json:"Metadata"`
+		Size      int           `json:"size"`
+		TotalSize int           `json:"totalSize"`
+	} `json:"MediaContainer"`
+}
+
+// HistoryItem is one playback in the history.
+type HistoryItem struct {
+	HistoryKey            string      `json:"historyKey"`
+	Key                   string      `json:"key"`
+	RatingKey             string      `json:"ratingKey"`
+	LibrarySectionID      json.Number `json:"librarySectionID"`
+	ParentKey             string      `json:"parentKey"`
+	GrandparentKey        string      `json:"grandparentKey"`
+	Title                 string      `json:"title"`
+	ParentTitle           string      `json:"parentTitle"`
+	GrandparentTitle      string      `json:"grandparentTitle"`
+	Type                  string      `json:"type"`
+	Index                 int64       `json:"index"`
+	ParentIndex           int64       `json:"parentIndex"`
+	OriginallyAvailableAt string      `json:"originallyAvailableAt"`
+	ViewedAt              int64       `json:"viewedAt"`
+	AccountID             int         `json:"accountID"`
+	DeviceID              int         `json:"deviceID"`
+}
+
 // CurrentSessions metadata of users consuming media.
 type CurrentSessions struct {
 	MediaContainer struct {
@@ -215,6 +298,7 @@ type Stream struct {
 	ChromaSubsampling  string      `json:"chromaSubsampling"`
 	Codec              string      `json:"codec"`
 	CodecID            string      `json:"codecID"`
+	Decision           string      `json:"decision"`
 	ColorRange         string      `json:"colorRange"`
 	ColorSpace         string      `json:"colorSpace"`
 	Default            bool        `json:"default"`
@@ -277,6 +361,17 @@ func (ag AltGUIDs) TMDB() int {
 	return 0
 }
 
+// IMDB returns the IMDb id, like tt0111161.
+func (ag AltGUIDs) IMDB() string {
+	for _, alt := range ag {
+		if id, ok := strings.CutPrefix(alt.ID, "imdb://"); ok {
+			return id
+		}
+	}
+
+	return ""
+}
+
 // AltGUID represents a Globally Unique Identifier for a metadata provider that is not actively being used.
 type AltGUID struct {
 	ID string `json:"id"`
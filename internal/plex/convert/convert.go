@@ -44,12 +44,14 @@ func SearchResultsToMovies(s *api.SearchResults) *library.Movies {
 			ContentRating:  m.ContentRating,
 			GUID:           m.GUID,
 			TMDB:           0,
+			IMDB:           "",
 			Key:            m.Key,
 			RatingKey:      m.RatingKey,
 			UserRating:     m.UserRating,
 			AudienceRating: m.AudienceRating,
 			Watched:        m.ViewCount > 0,
 			LastViewedAt:   timeOrNil(m.LastViewedAt),
+			ViewOffset:     m.ViewOffset,
 			AddedAt:        time.Unix(int64(m.AddedAt), 0),
 			UpdatedAt:      time.Unix(int64(m.UpdatedAt), 0),
 			RefreshedAt:    time.Now(),
@@ -84,12 +86,15 @@ func EpisodeResultsToEpisodes(s *api.SearchResultsEpisode) *library.Episodes {
 			SeasonNumber:  int(m.Index),
 			GUID:          m.GUID,
 			TVDB:          0,
+			IMDB:          "",
 			RatingKey:     m.RatingKey,
 			ContentRating: m.ContentRating,
 			Year:          m.Year,
+			UserRating:    m.UserRating,
 			Watched:       m.ViewCount > 0,
 			Duration:      m.Duration,
 			LastViewedAt:  timeOrNil(m.LastViewedAt),
+			ViewOffset:    m.ViewOffset,
 			AddedAt:       time.Unix(int64(m.AddedAt), 0),
 			UpdatedAt:     time.Unix(int64(m.UpdatedAt), 0),
 			RefreshedAt:   time.Now(),
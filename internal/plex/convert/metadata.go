@@ -43,11 +43,14 @@ func MetadataToEpisode(m *api.MediaMetadata) *library.Episode {
 				SeasonNumber:  int(md.Index),
 				GUID:          md.GUID,
 				TVDB:          0,
+				IMDB:          md.AltGUIDs.IMDB(),
 				ContentRating: md.ContentRating,
 				Year:          md.Year,
 				RatingKey:     md.RatingKey,
+				UserRating:    md.UserRating,
 				Watched:       md.ViewCount > 0,
 				LastViewedAt:  timeOrNil(md.LastViewedAt),
+				ViewOffset:    md.ViewOffset,
 				AddedAt:       time.Unix(int64(md.AddedAt), 0),
 				UpdatedAt:     time.Time{},
 				RefreshedAt:   time.Time{},
@@ -83,9 +86,12 @@ func UpdateEpisodeFromMetadata(m *api.MediaMetadata, ep *library.Episode) {
 			ep.ContentRating = md.ContentRating
 			ep.Year = md.Year
 			ep.TVDB = md.AltGUIDs.TVDB()
+			ep.IMDB = md.AltGUIDs.IMDB()
+			ep.UserRating = md.UserRating
 			ep.Watched = md.ViewCount > 0
 			ep.Duration = md.Duration
 			ep.LastViewedAt = timeOrNil(md.LastViewedAt)
+			ep.ViewOffset = md.ViewOffset
 			ep.AddedAt = time.Unix(int64(md.AddedAt), 0)
 			ep.RefreshedAt = time.Now()
 		}
@@ -102,7 +108,9 @@ func UpdateMovieFromMetadata(m *api.MediaMetadata, movie *library.Movie) {
 			movie.ContentRating = md.ContentRating
 			movie.Summary = md.Summary
 			movie.TMDB = md.AltGUIDs.TMDB()
+			movie.IMDB = md.AltGUIDs.IMDB()
 			movie.LastViewedAt = timeOrNil(md.LastViewedAt)
+			movie.ViewOffset = md.ViewOffset
 			movie.AddedAt = time.Unix(int64(md.AddedAt), 0)
 			movie.RefreshedAt = time.Now()
 		}
@@ -80,6 +80,26 @@ type TranscodeSession struct {
 	VideoDecision        string  `json:"videoDecision"`
 }
 
+// AccountUpdateNotification ...
+type AccountUpdateNotification struct {
+	AccountID  int64  `json:"accountID"`
+	Identifier string `json:"identifier"`
+	State      string `json:"state"`
+}
+
+// ProgressNotification ...
+type ProgressNotification struct {
+	Message string `json:"message"`
+}
+
+// AutoUpdateNotification ...
+type AutoUpdateNotification struct {
+	Key     string `json:"key"`
+	Version string `json:"version"`
+	State   string `json:"state"`
+	Error   string `json:"error"`
+}
+
 // Setting ...
 type Setting struct {
 	Advanced bool   `json:"advanced"`
@@ -111,15 +131,25 @@ type Container struct {
 
 	Setting []Setting `json:"Setting"`
 
+	AccountUpdateNotification []AccountUpdateNotification `json:"AccountUpdateNotification"`
+
+	ProgressNotification []ProgressNotification `json:"ProgressNotification"`
+
+	AutoUpdateNotification []AutoUpdateNotification `json:"AutoUpdateNotification"`
+
 	Size int64 `json:"size"`
 	// Type can be one of:
 	// playing,
+	// timeline,
 	// reachability,
 	// transcode.end,
 	// preference,
 	// update.statechange,
 	// activity,
 	// backgroundProcessingQueue,
+	// status,
+	// account,
+	// progress,
 	// transcodeSession.update
 	// transcodeSession.end
 	Type string `json:"type"`
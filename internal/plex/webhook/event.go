@@ -1,10 +1,14 @@
 package webhook
 
+import "github.com/kjbreil/go-plex/internal/plex/api"
+
 // Event contains a webhooks information.
 type Event struct {
-	Event   string `json:"event"`
-	User    bool   `json:"user"`
-	Owner   bool   `json:"owner"`
+	Event string `json:"event"`
+	User  bool   `json:"user"`
+	Owner bool   `json:"owner"`
+	// Rating is the new rating of a media.rate event, from 0 to 10.
+	Rating  float64 `json:"rating"`
 	Account struct {
 		ID    int    `json:"id"`
 		Thumb string `json:"thumb"`
@@ -19,30 +23,29 @@ type Event struct {
 		PublicAddress string `json:"PublicAddress"`
 		Title         string `json:"title"`
 		UUID          string `json:"uuid"`
+		// Product and Platform are set on device.new events.
+		Product  string `json:"product"`
+		Platform string `json:"platform"`
 	} `json:"Player"`
-	Metadata struct {
-		LibrarySectionType   string `json:"librarySectionType"`
-		RatingKey            string `json:"ratingKey"`
-		Key                  string `json:"key"`
-		ParentRatingKey      string `json:"parentRatingKey"`
-		GrandparentRatingKey string `json:"grandparentRatingKey"`
-		LibrarySectionID     int    `json:"librarySectionID"`
-		MediaType            string `json:"type"`
-		Title                string `json:"title"`
-		GrandparentKey       string `json:"grandparentKey"`
-		ParentKey            string `json:"parentKey"`
-		GrandparentTitle     string `json:"grandparentTitle"`
-		ParentTitle          string `json:"parentTitle"`
-		Summary              string `json:"summary"`
-		Index                int    `json:"index"`
-		ParentIndex          int    `json:"parentIndex"`
-		RatingCount          int    `json:"ratingCount"`
-		Thumb                string `json:"thumb"`
-		Art                  string `json:"art"`
-		ParentThumb          string `json:"parentThumb"`
-		GrandparentThumb     string `json:"grandparentThumb"`
-		GrandparentArt       string `json:"grandparentArt"`
-		AddedAt              int    `json:"addedAt"`
-		UpdatedAt            int    `json:"updatedAt"`
-	} `json:"Metadata"`
+	Metadata Metadata `json:"Metadata"`
+
+	// Thumbnail is the image Plex attaches to the payload, if it was sent and within the size limit.
+	Thumbnail []byte `json:"-"`
+}
+
+// Metadata is the item an event is about, in the shape the server API uses for metadata.
+type Metadata struct {
+	api.Metadata
+
+	LibrarySectionType string `json:"librarySectionType"`
+}
+
+// TVDB returns the TVDB ID of the item or 0 if it has none.
+func (m *Metadata) TVDB() int {
+	return m.AltGUIDs.TVDB()
+}
+
+// TMDB returns the TMDB ID of the item or 0 if it has none.
+func (m *Metadata) TMDB() int {
+	return m.AltGUIDs.TMDB()
 }
@@ -0,0 +1,353 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltOpenTimeout = time.Second
+
+//nolint:gochecknoglobals // bucket and key names are constant byte slices
+var (
+	bucketLibraries = []byte("libraries")
+	bucketMeta      = []byte("meta")
+	keyHeader       = []byte("header")
+	bucketMovies    = []byte("movies")
+	bucketShows     = []byte("shows")
+	keyLibrary      = []byte("library")
+)
+
+// Bolt caches the library model in an embedded bbolt database. Every library is stored in its own bucket and every
+// movie and show under its rating key, so Save only writes the items that changed and Load only reads the library
+// that is asked for.
+type Bolt struct {
+	db     *bolt.DB
+	config *config
+
+	machineIdentifier string
+}
+
+// NewBolt opens or creates the bbolt database at path.
+func NewBolt(path string, opts ...Option) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketLibraries, bucketMeta} {
+			if _, bucketErr := tx.CreateBucketIfNotExists(name); bucketErr != nil {
+				return bucketErr
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Bolt{
+		db:                db,
+		config:            newConfig(opts),
+		machineIdentifier: "",
+	}, nil
+}
+
+// Open checks that the database belongs to the server with machineIdentifier and migrates the libraries written by
+// an older schema version.
+func (c *Bolt) Open(machineIdentifier string) error {
+	c.machineIdentifier = machineIdentifier
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(bucketLibraries)
+
+		var h Header
+		if b := tx.Bucket(bucketMeta).Get(keyHeader); b != nil {
+			if err := json.Unmarshal(b, &h); err != nil {
+				return err
+			}
+		} else {
+			// databases written before the header existed are version 1, new ones are current
+			h.SchemaVersion = SchemaVersion
+			if k, _ := root.Cursor().First(); k != nil {
+				h.SchemaVersion = 1
+			}
+		}
+
+		if err := c.config.check(h, machineIdentifier); err != nil {
+			return err
+		}
+		if machineIdentifier == "" {
+			c.machineIdentifier = h.MachineIdentifier
+		}
+
+		if h.SchemaVersion < SchemaVersion {
+			if err := c.migrate(root, h.SchemaVersion); err != nil {
+				return err
+			}
+		}
+
+		return c.putHeader(tx, h.WrittenAt)
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return ErrClosed
+	}
+
+	return err
+}
+
+// migrate rewrites every library in root from version to SchemaVersion.
+func (c *Bolt) migrate(root *bolt.Bucket, version int) error {
+	var titles [][]byte
+	if err := root.ForEachBucket(func(k []byte) error {
+		titles = append(titles, bytes.Clone(k))
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, title := range titles {
+		raw, err := rawLibrary(root.Bucket(title))
+		if err != nil {
+			return err
+		}
+		if raw, err = c.config.migrate(version, raw); err != nil {
+			return err
+		}
+		var lib library.Library
+		if err = json.Unmarshal(raw, &lib); err != nil {
+			return err
+		}
+		if lib.Title != string(title) {
+			// libraries are keyed by title, drop the old bucket when a migration renames one
+			if err = root.DeleteBucket(title); err != nil {
+				return err
+			}
+		}
+		if err = saveLibrary(root, &lib); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rawLibrary assembles the JSON encoding of a library and its items from its bucket.
+func rawLibrary(lb *bolt.Bucket) (json.RawMessage, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(lb.Get(keyLibrary), &record); err != nil {
+		return nil, err
+	}
+
+	for field, name := range map[string][]byte{"Movies": bucketMovies, "Shows": bucketShows} {
+		var items []json.RawMessage
+		if b := lb.Bucket(name); b != nil {
+			if err := b.ForEach(func(_, v []byte) error {
+				items = append(items, bytes.Clone(v))
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+		raw, err := json.Marshal(items)
+		if err != nil {
+			return nil, err
+		}
+		record[field] = raw
+	}
+
+	return json.Marshal(record)
+}
+
+func (c *Bolt) putHeader(tx *bolt.Tx, writtenAt time.Time) error {
+	b, err := json.Marshal(Header{
+		SchemaVersion:     SchemaVersion,
+		MachineIdentifier: c.machineIdentifier,
+		WrittenAt:         writtenAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(bucketMeta).Put(keyHeader, b)
+}
+
+// Load returns the cached library with the same title as lib.
+func (c *Bolt) Load(lib *library.Library) (*library.Library, error) {
+	var cl *library.Library
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		lb := tx.Bucket(bucketLibraries).Bucket([]byte(lib.Title))
+		if lb == nil {
+			return nil
+		}
+
+		cl = &library.Library{}
+		if err := json.Unmarshal(lb.Get(keyLibrary), cl); err != nil {
+			return err
+		}
+
+		if err := forEachItem(lb, bucketMovies, func(movie *library.Movie) {
+			cl.Movies = append(cl.Movies, movie)
+		}); err != nil {
+			return err
+		}
+
+		return forEachItem(lb, bucketShows, func(show *library.Show) {
+			cl.Shows = append(cl.Shows, show)
+		})
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return nil, ErrClosed
+	}
+
+	return cl, err
+}
+
+// Save upserts every library and its items and removes whatever is no longer part of libs.
+func (c *Bolt) Save(libs library.Libraries) error {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(bucketLibraries)
+		keep := make(map[string]bool, len(libs))
+
+		for _, lib := range libs {
+			keep[lib.Title] = true
+			if err := saveLibrary(root, lib); err != nil {
+				return err
+			}
+		}
+
+		if err := deleteExcept(root, keep); err != nil {
+			return err
+		}
+
+		return c.putHeader(tx, time.Now())
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return ErrClosed
+	}
+
+	return err
+}
+
+// Close closes the database.
+func (c *Bolt) Close() error {
+	return c.db.Close()
+}
+
+func saveLibrary(root *bolt.Bucket, lib *library.Library) error {
+	lb, err := root.CreateBucketIfNotExists([]byte(lib.Title))
+	if err != nil {
+		return err
+	}
+
+	if err = put(lb, keyLibrary, withoutItems(lib)); err != nil {
+		return err
+	}
+
+	movies := make(map[string]any, len(lib.Movies))
+	for _, movie := range lib.Movies {
+		movies[movie.RatingKey] = movie
+	}
+	if err = saveItems(lb, bucketMovies, movies); err != nil {
+		return err
+	}
+
+	shows := make(map[string]any, len(lib.Shows))
+	for _, show := range lib.Shows {
+		shows[show.RatingKey] = show
+	}
+
+	return saveItems(lb, bucketShows, shows)
+}
+
+// saveItems upserts items by rating key into the named bucket of lb and deletes the keys not in items.
+func saveItems(lb *bolt.Bucket, name []byte, items map[string]any) error {
+	b, err := lb.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(items))
+	for ratingKey, item := range items {
+		if ratingKey == "" {
+			continue
+		}
+		keep[ratingKey] = true
+		if err = put(b, []byte(ratingKey), item); err != nil {
+			return err
+		}
+	}
+
+	return deleteExcept(b, keep)
+}
+
+// put stores v as JSON under key unless the stored value is already the same.
+func put(b *bolt.Bucket, key []byte, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(b.Get(key), value) {
+		return nil
+	}
+	return b.Put(key, value)
+}
+
+// deleteExcept removes every key and nested bucket of b that is not in keep.
+func deleteExcept(b *bolt.Bucket, keep map[string]bool) error {
+	var stale [][]byte
+	var staleBuckets [][]byte
+
+	err := b.ForEach(func(k, v []byte) error {
+		if keep[string(k)] {
+			return nil
+		}
+		// k points into the database pages, copy it before the bucket is modified below
+		key := bytes.Clone(k)
+		if v == nil {
+			staleBuckets = append(staleBuckets, key)
+		} else {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range stale {
+		if err = b.Delete(k); err != nil {
+			return err
+		}
+	}
+	for _, k := range staleBuckets {
+		if err = b.DeleteBucket(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func forEachItem[T any](lb *bolt.Bucket, name []byte, fn func(*T)) error {
+	b := lb.Bucket(name)
+	if b == nil {
+		return nil
+	}
+
+	return b.ForEach(func(_, v []byte) error {
+		item := new(T)
+		if err := json.Unmarshal(v, item); err != nil {
+			return err
+		}
+		fn(item)
+		return nil
+	})
+}
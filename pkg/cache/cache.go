@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+// SchemaVersion is the version of the cache layout written by this package. Version 1 is the bare JSON array of
+// libraries written before caches carried a Header.
+const SchemaVersion = 2
+
+var (
+	// ErrClosed is returned when a cache is used after Close.
+	ErrClosed = errors.New("cache is closed")
+	// ErrServerMismatch is returned by Open when the cache was written for a different server.
+	ErrServerMismatch = errors.New("cache belongs to a different server")
+	// ErrUnsupportedVersion is returned by Open when the cache cannot be migrated to SchemaVersion.
+	ErrUnsupportedVersion = errors.New("unsupported cache schema version")
+)
+
+// Cache persists the library model between runs so a restart does not need to fetch every item again.
+type Cache interface {
+	// Open checks the cache against the server it is used for and migrates it to SchemaVersion. It is called before
+	// Load and Save, a cache written for another server is rejected with ErrServerMismatch.
+	Open(machineIdentifier string) error
+	// Load returns the cached copy of lib including its items, or nil when lib is not cached.
+	Load(lib *library.Library) (*library.Library, error)
+	// Save stores libs, replacing whatever was cached before.
+	Save(libs library.Libraries) error
+	// Close releases the resources held by the cache.
+	Close() error
+}
+
+// Header describes which server a cache belongs to and how it was written.
+type Header struct {
+	SchemaVersion     int       `json:"schemaVersion"`
+	MachineIdentifier string    `json:"machineIdentifier"`
+	WrittenAt         time.Time `json:"writtenAt"`
+}
+
+// Migration upgrades the JSON encoding of one library, including its items, from one schema version to the next.
+type Migration func(lib json.RawMessage) (json.RawMessage, error)
+
+// Option configures a cache.
+type Option func(*config)
+
+// WithMigration registers the migration from schema version from to from+1, replacing the built-in one.
+func WithMigration(from int, m Migration) Option {
+	return func(c *config) {
+		c.migrations[from] = m
+	}
+}
+
+type config struct {
+	migrations map[int]Migration
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		migrations: map[int]Migration{
+			// version 2 only added the header, the libraries are encoded the same way
+			1: func(lib json.RawMessage) (json.RawMessage, error) { return lib, nil },
+		},
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// check validates h against the server the cache is opened for.
+func (c *config) check(h Header, machineIdentifier string) error {
+	if h.SchemaVersion < 1 || h.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.SchemaVersion)
+	}
+	// caches without an identifier predate the header and can belong to any server
+	if h.MachineIdentifier != "" && machineIdentifier != "" && h.MachineIdentifier != machineIdentifier {
+		return fmt.Errorf("%w: written for %s", ErrServerMismatch, h.MachineIdentifier)
+	}
+	return nil
+}
+
+// migrate upgrades lib from version to SchemaVersion.
+func (c *config) migrate(version int, lib json.RawMessage) (json.RawMessage, error) {
+	for v := version; v < SchemaVersion; v++ {
+		m, ok := c.migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration from version %d", ErrUnsupportedVersion, v)
+		}
+		var err error
+		if lib, err = m(lib); err != nil {
+			return nil, fmt.Errorf("migrating from version %d: %w", v, err)
+		}
+	}
+	return lib, nil
+}
+
+// withoutItems returns a copy of lib without its shows and movies.
+func withoutItems(lib *library.Library) *library.Library {
+	l := *lib
+	l.Shows = nil
+	l.Movies = nil
+	return &l
+}
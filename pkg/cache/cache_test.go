@@ -0,0 +1,321 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+	bolt "go.etcd.io/bbolt"
+)
+
+func testLibraries() library.Libraries {
+	refreshed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return library.Libraries{
+		{
+			Key:   "1",
+			Title: "Movies",
+			Type:  library.TypeMovie,
+			Movies: library.Movies{
+				{Title: "Alien", RatingKey: "10", TMDB: 348, RefreshedAt: refreshed},
+				{Title: "Aliens", RatingKey: "11", TMDB: 679, RefreshedAt: refreshed},
+			},
+			RefreshedAt: refreshed,
+		},
+		{
+			Key:   "2",
+			Title: "TV Shows",
+			Type:  library.TypeShow,
+			Shows: library.Shows{
+				{
+					Title:     "Bluey",
+					RatingKey: "20",
+					TVDB:      353546,
+					Seasons: library.Seasons{
+						1: {Title: "Season 1", Number: 1, RatingKey: "21", Episodes: library.Episodes{
+							1: {Title: "Magic Xylophone", RatingKey: "22", RefreshedAt: refreshed},
+						}},
+					},
+					RefreshedAt: refreshed,
+				},
+			},
+			RefreshedAt: refreshed,
+		},
+	}
+}
+
+func testCaches(t *testing.T) map[string]func() Cache {
+	t.Helper()
+	dir := t.TempDir()
+
+	return map[string]func() Cache{
+		"json": func() Cache {
+			return NewJSONFile(filepath.Join(dir, "cache.json"))
+		},
+		"bolt": func() Cache {
+			c, err := NewBolt(filepath.Join(dir, "cache.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		},
+	}
+}
+
+func TestCache_SaveLoad(t *testing.T) {
+	for name, open := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			c := open()
+			if err := c.Save(testLibraries()); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// reopen to make sure the data made it to disk
+			c = open()
+			defer c.Close()
+
+			movies, err := c.Load(&library.Library{Title: "Movies"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if movies == nil || movies.Key != "1" || len(movies.Movies) != 2 {
+				t.Fatalf("unexpected movie library %+v", movies)
+			}
+			if m := movies.Movies.FindRatingKey("11"); m == nil || m.TMDB != 679 {
+				t.Fatalf("unexpected movie %+v", m)
+			}
+
+			shows, err := c.Load(&library.Library{Title: "TV Shows"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shows == nil || len(shows.Shows) != 1 {
+				t.Fatalf("unexpected show library %+v", shows)
+			}
+			ep := shows.Shows[0].Seasons[1].Episodes[1]
+			if ep == nil || ep.Title != "Magic Xylophone" {
+				t.Fatalf("unexpected episode %+v", ep)
+			}
+
+			missing, err := c.Load(&library.Library{Title: "Music"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if missing != nil {
+				t.Fatalf("expected no library, got %+v", missing)
+			}
+		})
+	}
+}
+
+func TestCache_SaveRemovesStale(t *testing.T) {
+	for name, open := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			c := open()
+			defer c.Close()
+
+			libs := testLibraries()
+			if err := c.Save(libs); err != nil {
+				t.Fatal(err)
+			}
+
+			libs[0].Movies = libs[0].Movies[:1]
+			libs = libs[:1]
+			if err := c.Save(libs); err != nil {
+				t.Fatal(err)
+			}
+
+			movies, err := c.Load(&library.Library{Title: "Movies"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(movies.Movies) != 1 {
+				t.Fatalf("expected 1 movie, got %d", len(movies.Movies))
+			}
+			shows, err := c.Load(&library.Library{Title: "TV Shows"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shows != nil {
+				t.Fatalf("expected the show library to be removed, got %+v", shows)
+			}
+		})
+	}
+}
+
+func TestJSONFile_SaveLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	c := NewJSONFile(filepath.Join(dir, "cache.json"))
+
+	for range 3 {
+		if err := c.Save(testLibraries()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the cache file, got %v", entries)
+	}
+}
+
+func TestJSONFile_LoadCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewJSONFile(path).Load(&library.Library{Title: "Movies"})
+	if err == nil {
+		t.Fatal("expected a decode error")
+	}
+}
+
+func TestCache_Closed(t *testing.T) {
+	for name, open := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			c := open()
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Save(testLibraries()); err == nil {
+				t.Fatal("expected an error after close")
+			}
+		})
+	}
+}
+
+func TestCache_ServerMismatch(t *testing.T) {
+	for name, open := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			c := open()
+			if err := c.Open("server-a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Save(testLibraries()); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			c = open()
+			defer c.Close()
+			if err := c.Open("server-b"); !errors.Is(err, ErrServerMismatch) {
+				t.Fatalf("expected ErrServerMismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJSONFile_NewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(path, []byte(`{"schemaVersion":99,"libraries":[]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewJSONFile(path).Open("server-a"); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+// renameMigration upper cases the title of every library.
+func renameMigration(called *int) Migration {
+	return func(lib json.RawMessage) (json.RawMessage, error) {
+		*called++
+		var record map[string]any
+		if err := json.Unmarshal(lib, &record); err != nil {
+			return nil, err
+		}
+		record["title"] = strings.ToUpper(record["title"].(string))
+		return json.Marshal(record)
+	}
+}
+
+func TestJSONFile_MigrateVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	legacy, err := json.Marshal(testLibraries())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, legacy, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var called int
+	c := NewJSONFile(path, WithMigration(1, renameMigration(&called)))
+	if err = c.Open("server-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, err := c.Load(&library.Library{Title: "MOVIES"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movies == nil || len(movies.Movies) != 2 {
+		t.Fatalf("unexpected migrated library %+v", movies)
+	}
+	if called != 2 {
+		t.Fatalf("expected the migration to run for both libraries, ran %d times", called)
+	}
+}
+
+func TestBolt_MigrateVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	c, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Save(testLibraries()); err != nil {
+		t.Fatal(err)
+	}
+	// databases written before the header existed have no meta bucket entry
+	if err = c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Delete(keyHeader)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var called int
+	c, err = NewBolt(path, WithMigration(1, renameMigration(&called)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err = c.Open("server-a"); err != nil {
+		t.Fatal(err)
+	}
+	if called != 2 {
+		t.Fatalf("expected the migration to run for both libraries, ran %d times", called)
+	}
+
+	shows, err := c.Load(&library.Library{Title: "TV SHOWS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shows == nil || len(shows.Shows) != 1 || shows.Shows[0].Seasons[1].Episodes[1] == nil {
+		t.Fatalf("unexpected migrated library %+v", shows)
+	}
+
+	// the second open finds the current version and does not migrate again
+	if err = c.Open("server-a"); err != nil {
+		t.Fatal(err)
+	}
+	if called != 2 {
+		t.Fatalf("expected no further migrations, ran %d times", called)
+	}
+}
@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+// JSONFile caches the whole library tree in a single JSON file. The file is read on Open, decoded on the first Load
+// and replaced atomically on Save.
+type JSONFile struct {
+	path   string
+	config *config
+
+	mu                sync.Mutex
+	opened            bool
+	closed            bool
+	machineIdentifier string
+	header            Header
+	raw               []json.RawMessage
+	libraries         library.Libraries
+}
+
+type jsonEnvelope struct {
+	Header
+
+	Libraries []json.RawMessage `json:"libraries"`
+}
+
+// NewJSONFile returns a cache backed by the JSON file at path. The file does not need to exist yet.
+func NewJSONFile(path string, opts ...Option) *JSONFile {
+	return &JSONFile{
+		path:              path,
+		config:            newConfig(opts),
+		mu:                sync.Mutex{},
+		opened:            false,
+		closed:            false,
+		machineIdentifier: "",
+		header:            Header{},
+		raw:               nil,
+		libraries:         nil,
+	}
+}
+
+// Open reads the cache file and checks that it belongs to the server with machineIdentifier.
+func (c *JSONFile) Open(machineIdentifier string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	c.machineIdentifier = machineIdentifier
+
+	return c.open()
+}
+
+func (c *JSONFile) open() error {
+	c.raw = nil
+	c.libraries = nil
+
+	file, err := os.ReadFile(c.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			c.opened = true
+			return nil
+		}
+		return err
+	}
+
+	var env jsonEnvelope
+	if trimmed := bytes.TrimSpace(file); len(trimmed) > 0 && trimmed[0] == '[' {
+		// version 1 wrote the libraries without a header
+		env.SchemaVersion = 1
+		err = json.Unmarshal(trimmed, &env.Libraries)
+	} else {
+		err = json.Unmarshal(file, &env)
+	}
+	if err != nil {
+		return fmt.Errorf("could not decode cache %s: %w", c.path, err)
+	}
+
+	if err = c.config.check(env.Header, c.machineIdentifier); err != nil {
+		return err
+	}
+
+	if c.machineIdentifier == "" {
+		c.machineIdentifier = env.MachineIdentifier
+	}
+	c.header = env.Header
+	c.raw = env.Libraries
+	c.opened = true
+
+	return nil
+}
+
+// Load returns the cached library with the same title as lib.
+func (c *JSONFile) Load(lib *library.Library) (*library.Library, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	if !c.opened {
+		if err := c.open(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.raw != nil {
+		if err := c.decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, cl := range c.libraries {
+		if cl.Title == lib.Title {
+			return cl, nil
+		}
+	}
+
+	return nil, nil //nolint:nilnil // a library that is not cached is not an error
+}
+
+// decode migrates and decodes the raw libraries read by open.
+func (c *JSONFile) decode() error {
+	libs := make(library.Libraries, 0, len(c.raw))
+	for _, raw := range c.raw {
+		migrated, err := c.config.migrate(c.header.SchemaVersion, raw)
+		if err != nil {
+			return err
+		}
+		var lib library.Library
+		if err = json.Unmarshal(migrated, &lib); err != nil {
+			return fmt.Errorf("could not decode cache %s: %w", c.path, err)
+		}
+		libs = append(libs, &lib)
+	}
+
+	c.libraries = libs
+	c.raw = nil
+
+	return nil
+}
+
+// Save writes libs to a temporary file next to the cache and renames it over the old one, so a crash never leaves
+// a partially written cache behind.
+func (c *JSONFile) Save(libs library.Libraries) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	env := jsonEnvelope{
+		Header: Header{
+			SchemaVersion:     SchemaVersion,
+			MachineIdentifier: c.machineIdentifier,
+			WrittenAt:         time.Now(),
+		},
+		Libraries: make([]json.RawMessage, 0, len(libs)),
+	}
+	for _, lib := range libs {
+		b, err := json.Marshal(lib)
+		if err != nil {
+			return err
+		}
+		env.Libraries = append(env.Libraries, b)
+	}
+
+	b, err := json.Marshal(&env)
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(c.path, b); err != nil {
+		return err
+	}
+
+	// the next Load should see what was just written instead of the stale copy
+	c.opened = false
+	c.raw = nil
+	c.libraries = nil
+
+	return nil
+}
+
+// Close marks the cache as closed.
+func (c *JSONFile) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	c.raw = nil
+	c.libraries = nil
+
+	return nil
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// a no-op once the rename succeeded
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -39,11 +39,14 @@ type Episode struct {
 	SeasonNumber  int        `json:"seasonNumber"`
 	GUID          string     `json:"guid"`
 	TVDB          int        `json:"tvdb"`
+	IMDB          string     `json:"imdb"`
 	ContentRating string     `json:"contentRating"`
 	Year          int        `json:"year"`
 	RatingKey     string     `json:"ratingKey"`
+	UserRating    float64    `json:"userRating"`
 	Watched       bool       `json:"watched"`
 	LastViewedAt  *time.Time `json:"lastViewedAt"`
+	ViewOffset    int        `json:"viewOffset"`
 	AddedAt       time.Time  `json:"addedAt"`
 	UpdatedAt     time.Time  `json:"updatedAt"`
 	RefreshedAt   time.Time  `json:"refreshedAt"`
@@ -18,6 +18,16 @@ func (l Libraries) Type(t LibraryType) Libraries {
 	return nl
 }
 
+// FindMovie gets the movie for a RatingKey.
+func (l Libraries) FindMovie(ratingKey string) *Movie {
+	for _, lib := range l {
+		if movie := lib.Movies.FindRatingKey(ratingKey); movie != nil {
+			return movie
+		}
+	}
+	return nil
+}
+
 // FindEpisode gets the show season and epsidoe for a RatingKey.
 func (l Libraries) FindEpisode(ratingKey string) (*Show, *Season, *Episode) {
 	for _, lib := range l {
@@ -50,12 +50,14 @@ type Movie struct {
 	ContentRating  string     `json:"contentRating"`
 	GUID           string     `json:"guid"`
 	TMDB           int        `json:"tmdb"`
+	IMDB           string     `json:"imdb"`
 	Key            string     `json:"key"`
 	RatingKey      string     `json:"ratingKey"`
 	UserRating     float64    `json:"userRating"`
 	AudienceRating float64    `json:"audienceRating"`
 	Watched        bool       `json:"watched"`
 	LastViewedAt   *time.Time `json:"lastViewedAt"`
+	ViewOffset     int        `json:"viewOffset"`
 	AddedAt        time.Time  `json:"addedAt"`
 	UpdatedAt      time.Time  `json:"updatedAt"`
 
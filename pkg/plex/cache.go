@@ -1,47 +1,58 @@
 package plex
 
 import (
-	"encoding/json"
-	"os"
+	"errors"
+	"fmt"
 
-	"github.com/kjbreil/go-plex/pkg/library"
+	"github.com/kjbreil/go-plex/pkg/cache"
 )
 
-func (p *Plex) mergeCache() {
-	if p.cacheLibrary == "" {
-		return
+// mergeCache merges the cached copy of each library into p.Libraries.
+func (p *Plex) mergeCache() error {
+	if p.cache == nil {
+		return nil
 	}
 
-	file, err := os.ReadFile(p.cacheLibrary)
-	if err != nil {
-		return
-	}
-
-	var cacheLibrary library.Libraries
-	if err = json.Unmarshal(file, &cacheLibrary); err != nil {
-		return
+	if err := p.cache.Open(p.machineIdentifier); err != nil {
+		if errors.Is(err, cache.ErrServerMismatch) || errors.Is(err, cache.ErrUnsupportedVersion) {
+			// never overwrite a cache that cannot be read, it belongs to another server or a newer version
+			_ = p.cache.Close()
+			p.cache = nil
+		}
+		return fmt.Errorf("could not open cache: %w", err)
 	}
 
-	for _, cl := range cacheLibrary {
-		merged := false
-		for i := range p.Libraries {
-			if cl.Title == p.Libraries[i].Title {
-				p.Libraries[i].Merge(cl)
-				merged = true
-				break
-			}
+	var errs []error
+	for _, lib := range p.Libraries {
+		cl, err := p.cache.Load(lib)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not load library %s from cache: %w", lib.Title, err))
+			continue
 		}
-		if !merged {
-			p.Libraries = append(p.Libraries, cl)
+		if cl != nil {
+			lib.Merge(cl)
 		}
 	}
+
+	return errors.Join(errs...)
 }
 
-func (p *Plex) WriteCache() {
-	if p.cacheLibrary != "" {
-		b, err := json.Marshal(&p.Libraries)
-		if err == nil {
-			_ = os.WriteFile(p.cacheLibrary, b, 0600)
-		}
+// WriteCache saves the libraries to the cache. It waits for a running populate to finish.
+func (p *Plex) WriteCache() error {
+	p.populateMu.Lock()
+	defer p.populateMu.Unlock()
+
+	return p.writeCache()
+}
+
+// writeCache saves the libraries to the cache, the caller must hold populateMu.
+func (p *Plex) writeCache() error {
+	if p.cache == nil {
+		return nil
 	}
+
+	p.libraryMu.RLock()
+	defer p.libraryMu.RUnlock()
+
+	return p.cache.Save(p.Libraries)
 }
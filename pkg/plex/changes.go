@@ -0,0 +1,41 @@
+package plex
+
+import "time"
+
+// ChangeType names a change this client made to an item on the server.
+type ChangeType string
+
+const (
+	ChangeRate ChangeType = "rate"
+	ChangeEdit ChangeType = "edit"
+)
+
+// ChangeEvent is a change this client made to an item on the server, published once the server applied it.
+type ChangeEvent struct {
+	Type      ChangeType
+	RatingKey string
+	// Fields are the changed fields with their new values, named like in the Plex API, like userRating.
+	Fields  map[string]string
+	Applied time.Time
+
+	// LibraryItem is the changed item, the change is already applied to it.
+	LibraryItem
+}
+
+// OnChange is called for every change this client made to an item on the server, like Rate or EditMetadata.
+func (p *Plex) OnChange(fn func(e ChangeEvent)) func() {
+	return p.changes.subscribe(fn, nil)
+}
+
+// applyChange applies e to the item in Libraries with update and publishes it. Changes made at the same time wait for
+// each other. A populate changes the items in place, so while one is running the item is left alone, the populate
+// fetches the change from the server anyway.
+func (p *Plex) applyChange(e ChangeEvent, update func(e *ChangeEvent)) {
+	if e.RatingKey != "" && p.lockChange() {
+		e.LibraryItem = p.lookupItem(e.RatingKey)
+		update(&e)
+		p.libraryMu.Unlock()
+	}
+
+	logDropped(p.logger, p.changes.publish(e), "change")
+}
@@ -3,6 +3,7 @@ package plex
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/kjbreil/go-plex/internal/plex/api"
 	"github.com/kjbreil/go-plex/internal/plex/convert"
+	"github.com/kjbreil/go-plex/pkg/cache"
 	"github.com/kjbreil/go-plex/pkg/library"
 )
 
@@ -20,6 +22,7 @@ const bufLen = 3
 
 type Plex struct {
 	url            *url.URL
+	plexTV         string
 	token          string
 	defaultHeaders http.Header
 	httpClient     http.Client
@@ -30,11 +33,24 @@ type Plex struct {
 
 	wg *sync.WaitGroup
 
+	// populateMu makes sure only one populate runs at a time.
+	populateMu   sync.Mutex
+	lastPopulate time.Time
+	// libraryMu guards the items in Libraries, a populate holds it while it changes them.
+	libraryMu sync.RWMutex
+	// populating is set while a populate holds libraryMu, so changes can skip Libraries instead of waiting for it.
+	populatingMu sync.Mutex
+	populating   bool
+
 	Websocket *NotificationEvents
 	Webhook   *Webhook
+	playback  *playbackBus
+	changes   subscribers[ChangeEvent]
+
+	machineIdentifier string
 
-	cacheLibrary string
-	logger       *slog.Logger
+	cache  cache.Cache
+	logger *slog.Logger
 }
 
 type Options func(*Plex)
@@ -43,9 +59,11 @@ func New(baseURL, token string, options ...Options) (*Plex, error) {
 	var p Plex
 
 	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.plexTV = PlexURL
 	p.logger = slog.Default()
 	p.wg = &sync.WaitGroup{}
 	p.Websocket = NewNotificationEvents()
+	p.playback = newPlaybackBus(&p)
 
 	if baseURL == "" && token == "" {
 		return &p, errors.New("url or token is required")
@@ -70,6 +88,7 @@ func New(baseURL, token string, options ...Options) (*Plex, error) {
 	for _, o := range options {
 		o(&p)
 	}
+	p.Websocket.logger = p.logger
 
 	var err error
 
@@ -97,7 +116,7 @@ func New(baseURL, token string, options ...Options) (*Plex, error) {
 
 // GetLibraries of your Plex server.
 func (p *Plex) GetLibraries() (library.Libraries, error) {
-	resp, err := get[api.LibrarySections](p, "/library/sections", nil)
+	resp, err := get[api.LibrarySections](p.ctx, p, "/library/sections", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -107,85 +126,128 @@ func (p *Plex) GetLibraries() (library.Libraries, error) {
 	return resp.MediaContainer.Directory, nil
 }
 
+// GetMachineIdentifier of your Plex server.
+func (p *Plex) GetMachineIdentifier() (string, error) {
+	resp, err := get[api.Identity](p.ctx, p, "/identity", nil)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.MediaContainer.MachineIdentifier, nil
+}
+
 // GetLibraryShows adds the shows to the Library.
 func (p *Plex) GetLibraryShows(lib *library.Library, filter string) error {
-	query := path.Join("/library/sections/", lib.Key, "all"+filter)
-	resp, err := get[api.SearchResults](p, query, nil)
-	lib.Shows.Merge(convert.SearchResultsToShows(&resp))
-	var md api.MediaMetadata
+	_, err := p.getLibraryShows(p.ctx, lib, filter, nil)
+	return err
+}
 
-	for _, show := range lib.Shows {
-		md, err = p.GetMetadata(show.RatingKey)
-		if err != nil {
-			return err
+// getLibraryShows merges the shows matching filter and query into lib and returns them.
+func (p *Plex) getLibraryShows(
+	ctx context.Context,
+	lib *library.Library,
+	filter string,
+	query url.Values,
+) ([]*library.Show, error) {
+	urlPath := path.Join("/library/sections/", lib.Key, "all"+filter)
+	resp, err := get[api.SearchResults](ctx, p, urlPath, query)
+	if err != nil {
+		return nil, err
+	}
+	fetched := convert.SearchResultsToShows(&resp)
+	lib.Shows.Merge(fetched)
+	shows := refreshed(lib.Shows, *fetched, func(show *library.Show) string { return show.RatingKey })
+
+	results, err := runTasks(ctx, bufLen, shows, func(ctx context.Context, show *library.Show) error {
+		md, mdErr := p.getMetadata(ctx, show.RatingKey)
+		if mdErr != nil {
+			return mdErr
 		}
-
 		convert.UpdateShowFromMetadata(&md, show)
+		return nil
+	})
+	if err != nil {
+		return shows, err
 	}
 
-	return err
+	return shows, taskErrors(results, func(show *library.Show, err error) error {
+		return fmt.Errorf("show %q (%s): %w", show.Title, show.RatingKey, err)
+	})
 }
 
 // GetLibraryMovies adds the movies to the Library.
 func (p *Plex) GetLibraryMovies(lib *library.Library, filter string) error {
-	query := path.Join("/library/sections/", lib.Key, "all"+filter)
-	resp, err := get[api.SearchResults](p, query, nil)
-
-	respMovies := convert.SearchResultsToMovies(&resp)
-	lib.Movies.Merge(respMovies)
-	var md api.MediaMetadata
-
-	buf := make(chan struct{}, bufLen)
-	wg := sync.WaitGroup{}
-
-	wg.Add(len(lib.Movies))
-
-	for _, movie := range lib.Movies {
-		go func(ratingKey string) {
-			buf <- struct{}{}
-			defer func() {
-				<-buf
-				wg.Done()
-			}()
-			// exit out if the context is canceled
-			if p.ctx.Err() != nil {
-				return
-			}
-			md, err = p.GetMetadata(ratingKey)
-			if err != nil {
-				slog.Error("could not Get metadata", "ratingKey", ratingKey, "movie", movie.Title, "err", err.Error())
-			} else {
-				convert.UpdateMovieFromMetadata(&md, movie)
-			}
-		}(movie.RatingKey)
-	}
+	return p.getLibraryMovies(p.ctx, lib, filter, nil)
+}
 
-	wg.Wait()
+// getLibraryMovies merges the movies matching filter and query into lib.
+func (p *Plex) getLibraryMovies(ctx context.Context, lib *library.Library, filter string, query url.Values) error {
+	urlPath := path.Join("/library/sections/", lib.Key, "all"+filter)
+	resp, err := get[api.SearchResults](ctx, p, urlPath, query)
+	if err != nil {
+		return err
+	}
+	fetched := convert.SearchResultsToMovies(&resp)
+	lib.Movies.Merge(fetched)
+	movies := refreshed(lib.Movies, *fetched, func(movie *library.Movie) string { return movie.RatingKey })
+
+	results, err := runTasks(ctx, bufLen, movies, func(ctx context.Context, movie *library.Movie) error {
+		md, mdErr := p.getMetadata(ctx, movie.RatingKey)
+		if mdErr != nil {
+			return mdErr
+		}
+		convert.UpdateMovieFromMetadata(&md, movie)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	return taskErrors(results, func(movie *library.Movie, err error) error {
+		return fmt.Errorf("movie %q (%s): %w", movie.Title, movie.RatingKey, err)
+	})
 }
 
-// GetSessions of devices currently consuming media.
-func (p *Plex) GetSessions() (api.CurrentSessions, error) {
-	urlPath := "/status/sessions"
-	return get[api.CurrentSessions](p, urlPath, nil)
+// refreshed returns the items of all that share a rating key with one of fetched. Merging copies fetched items into
+// the ones already in the library, so these are the items that need their metadata updated.
+func refreshed[T any](all, fetched []T, ratingKey func(T) string) []T {
+	byKey := make(map[string]T, len(all))
+	for _, item := range all {
+		byKey[ratingKey(item)] = item
+	}
+
+	items := make([]T, 0, len(fetched))
+	for _, f := range fetched {
+		if item, ok := byKey[ratingKey(f)]; ok {
+			items = append(items, item)
+		}
+	}
+
+	return items
 }
 
 func (p *Plex) GetShowEpisodes(show *library.Show) error {
+	return p.getShowEpisodes(p.ctx, show)
+}
+
+func (p *Plex) getShowEpisodes(ctx context.Context, show *library.Show) error {
 	if show == nil {
 		return errors.New("no show provided")
 	}
 	query := path.Join("/library/metadata/", show.RatingKey, "children")
 
-	resp, err := get[api.SearchResultsEpisode](p, query, nil)
+	resp, err := get[api.SearchResultsEpisode](ctx, p, query, nil)
 	if err != nil {
 		return err
 	}
 	show.Seasons.Merge(convert.EpisodeResultsToSeasons(&resp))
 
 	for _, sea := range show.Seasons {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		query = path.Join("/library/metadata/", sea.RatingKey, "children")
-		resp, err = get[api.SearchResultsEpisode](p, query, nil)
+		resp, err = get[api.SearchResultsEpisode](ctx, p, query, nil)
 		if err != nil {
 			p.logger.Error("could not get season metadata", "err", err.Error())
 			continue
@@ -195,7 +257,10 @@ func (p *Plex) GetShowEpisodes(show *library.Show) error {
 		var md api.MediaMetadata
 
 		for _, ep := range sea.Episodes {
-			md, err = p.GetMetadata(ep.RatingKey)
+			md, err = p.getMetadata(ctx, ep.RatingKey)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			if err != nil {
 				p.logger.Error("could not get episode metadata", "err", err.Error())
 				continue
@@ -208,12 +273,16 @@ func (p *Plex) GetShowEpisodes(show *library.Show) error {
 }
 
 func (p *Plex) GetMetadata(ratingKey string) (api.MediaMetadata, error) {
+	return p.getMetadata(p.ctx, ratingKey)
+}
+
+func (p *Plex) getMetadata(ctx context.Context, ratingKey string) (api.MediaMetadata, error) {
 	if ratingKey == "" {
 		return api.MediaMetadata{}, errors.New("no ratingKey provided")
 	}
 	query := path.Join("/library/metadata/", ratingKey)
 
-	resp, err := get[api.MediaMetadata](p, query, nil)
+	resp, err := get[api.MediaMetadata](ctx, p, query, nil)
 
 	return resp, err
 }
@@ -223,18 +292,18 @@ type blank struct{}
 func (p *Plex) Scrobble(key string) error {
 	query := url.Values{}
 	query.Add("key", key)
-	query.Add("identifier", "com.plexapp.plugins.library")
+	query.Add("identifier", libraryIdentifier)
 
-	_, err := get[blank](p, "/:/scrobble", query)
+	_, err := get[blank](p.ctx, p, "/:/scrobble", query)
 	return err
 }
 
 func (p *Plex) UnScrobble(key string) error {
 	query := url.Values{}
 	query.Add("key", key)
-	query.Add("identifier", "com.plexapp.plugins.library")
+	query.Add("identifier", libraryIdentifier)
 
-	_, err := get[blank](p, "/:/unscrobble", query)
+	_, err := get[blank](p.ctx, p, "/:/unscrobble", query)
 	return err
 }
 
@@ -244,7 +313,7 @@ func (p *Plex) ScanLibrary(lib *library.Library) error {
 	for _, loc := range lib.Location {
 		query := url.Values{}
 		query.Add("path", loc.Path)
-		_, err := get[blank](p, urlPath, query)
+		_, err := get[blank](p.ctx, p, urlPath, query)
 		if err != nil {
 			return err
 		}
@@ -252,9 +321,42 @@ func (p *Plex) ScanLibrary(lib *library.Library) error {
 	return nil
 }
 
+// untilClosed returns a context that stops on whichever comes first, the callers context or Close.
+func (p *Plex) untilClosed(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(p.ctx, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
 func (p *Plex) Close() {
 	p.cancel()
-	p.removeWebhooks()
+	if p.Webhook != nil {
+		if err := p.removeWebhooks(); err != nil {
+			p.logger.Error("could not remove webhooks", "err", err.Error())
+		}
+		if err := p.Webhook.shutdown(); err != nil {
+			p.logger.Error("could not shut down webhook server", "err", err.Error())
+		}
+	}
 	p.wg.Wait()
-	p.WriteCache()
+	p.Websocket.close()
+	if p.Webhook != nil {
+		p.Webhook.close()
+	}
+	p.playback.close()
+	p.changes.close()
+
+	if p.cache == nil {
+		return
+	}
+	if err := p.WriteCache(); err != nil {
+		p.logger.Error("could not write cache", "err", err.Error())
+	}
+	if err := p.cache.Close(); err != nil {
+		p.logger.Error("could not close cache", "err", err.Error())
+	}
 }
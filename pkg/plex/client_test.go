@@ -107,7 +107,9 @@ func TestPlex_PopulateLibraries(t *testing.T) {
 		t.Fatal(err)
 	}
 	done := conn.PopulateLibraries()
-	done()
+	if err = done(); err != nil {
+		t.Fatal(err)
+	}
 	if len(conn.Libraries) == 0 {
 		t.Fatal("no libraries found")
 	}
@@ -0,0 +1,188 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// MetadataField is a field of an item EditMetadata can change and lock.
+type MetadataField string
+
+const (
+	FieldTitle         MetadataField = "title"
+	FieldTitleSort     MetadataField = "titleSort"
+	FieldOriginalTitle MetadataField = "originalTitle"
+	FieldSummary       MetadataField = "summary"
+	FieldYear          MetadataField = "year"
+	FieldContentRating MetadataField = "contentRating"
+)
+
+// MetadataEdit changes the fields of an item that are not nil.
+type MetadataEdit struct {
+	Title         *string
+	TitleSort     *string
+	OriginalTitle *string
+	Summary       *string
+	Year          *int
+	ContentRating *string
+
+	// Lock locks the changed fields so the agent keeps them when it refreshes the item.
+	Lock bool
+	// Unlock unlocks fields so the agent updates them again.
+	Unlock []MetadataField
+}
+
+// BatchEdit is one edit of EditMetadataBatch.
+type BatchEdit struct {
+	RatingKey string
+	Edit      MetadataEdit
+}
+
+// EditMetadata changes and locks the fields of a movie, show, season or episode. Once the server applied the edit it
+// is applied to the item in Libraries and published to OnChange and Events. Libraries has no sort and original
+// titles, they are only changed on the server.
+func (p *Plex) EditMetadata(ctx context.Context, ratingKey string, edit MetadataEdit) error {
+	if ratingKey == "" {
+		return errors.New("no ratingKey provided")
+	}
+	fields := edit.fields()
+	if len(fields) == 0 && len(edit.Unlock) == 0 {
+		return errors.New("metadata edit changes nothing")
+	}
+
+	md, err := p.getMetadata(ctx, ratingKey)
+	if err != nil {
+		return err
+	}
+	if len(md.MediaContainer.Metadata) == 0 {
+		return fmt.Errorf("item %s not found", ratingKey)
+	}
+	m := md.MediaContainer.Metadata[0]
+	itemType, ok := metadataType(m.Type)
+	if !ok {
+		return fmt.Errorf("cannot edit item %s of type %q", ratingKey, m.Type)
+	}
+	section := m.LibrarySectionID.String()
+	if section == "" && md.MediaContainer.LibrarySectionID != 0 {
+		section = strconv.Itoa(md.MediaContainer.LibrarySectionID)
+	}
+	if section == "" {
+		return fmt.Errorf("item %s is not in a library", ratingKey)
+	}
+
+	query := url.Values{}
+	query.Set("type", strconv.Itoa(itemType))
+	query.Set("id", ratingKey)
+	for field, value := range fields {
+		query.Set(field+".value", value)
+		if edit.Lock {
+			query.Set(field+".locked", "1")
+		}
+	}
+	for _, field := range edit.Unlock {
+		query.Set(string(field)+".locked", "0")
+	}
+
+	if err = put(ctx, p, path.Join("/library/sections", section, "all"), query); err != nil {
+		return err
+	}
+
+	p.applyChange(ChangeEvent{
+		Type:        ChangeEdit,
+		RatingKey:   ratingKey,
+		Fields:      fields,
+		Applied:     time.Now(),
+		LibraryItem: LibraryItem{},
+	}, edit.apply)
+
+	return nil
+}
+
+// EditMetadataBatch runs the edits on a few workers. Every edit is tried, the errors of the failed ones are joined.
+func (p *Plex) EditMetadataBatch(ctx context.Context, edits []BatchEdit) error {
+	results, err := runTasks(ctx, bufLen, edits, func(ctx context.Context, e BatchEdit) error {
+		return p.EditMetadata(ctx, e.RatingKey, e.Edit)
+	})
+	if err != nil {
+		return err
+	}
+
+	return taskErrors(results, func(e BatchEdit, err error) error {
+		return fmt.Errorf("edit %s: %w", e.RatingKey, err)
+	})
+}
+
+// fields returns the changed fields with their new values.
+func (edit *MetadataEdit) fields() map[string]string {
+	fields := make(map[string]string)
+	set := func(field MetadataField, value *string) {
+		if value != nil {
+			fields[string(field)] = *value
+		}
+	}
+	set(FieldTitle, edit.Title)
+	set(FieldTitleSort, edit.TitleSort)
+	set(FieldOriginalTitle, edit.OriginalTitle)
+	set(FieldSummary, edit.Summary)
+	set(FieldContentRating, edit.ContentRating)
+	if edit.Year != nil {
+		fields[string(FieldYear)] = strconv.Itoa(*edit.Year)
+	}
+	return fields
+}
+
+// apply sets the changed fields Libraries knows on the edited item.
+func (edit *MetadataEdit) apply(e *ChangeEvent) {
+	switch {
+	case e.Movie != nil:
+		setIf(&e.Movie.Title, edit.Title)
+		setIf(&e.Movie.Summary, edit.Summary)
+		setIf(&e.Movie.Year, edit.Year)
+		setIf(&e.Movie.ContentRating, edit.ContentRating)
+	case e.Episode != nil:
+		setIf(&e.Episode.Title, edit.Title)
+		setIf(&e.Episode.Year, edit.Year)
+		setIf(&e.Episode.ContentRating, edit.ContentRating)
+	case e.Season != nil:
+		setIf(&e.Season.Title, edit.Title)
+	case e.Show != nil:
+		setIf(&e.Show.Title, edit.Title)
+		setIf(&e.Show.Summary, edit.Summary)
+		setIf(&e.Show.Year, edit.Year)
+		setIf(&e.Show.ContentRating, edit.ContentRating)
+	}
+}
+
+func setIf[T any](field *T, value *T) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// The numbers Plex uses for the type of an item in library section requests.
+const (
+	metadataMovie   = 1
+	metadataShow    = 2
+	metadataSeason  = 3
+	metadataEpisode = 4
+)
+
+func metadataType(t string) (int, bool) {
+	switch t {
+	case "movie":
+		return metadataMovie, true
+	case "show":
+		return metadataShow, true
+	case "season":
+		return metadataSeason, true
+	case "episode":
+		return metadataEpisode, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,164 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+// editServer serves the metadata of a movie and an episode and records the edits.
+type editServer struct {
+	mu    sync.Mutex
+	edits map[string]url.Values
+}
+
+func newEditConnection(t *testing.T) (*Plex, *editServer) {
+	t.Helper()
+
+	es := &editServer{mu: sync.Mutex{}, edits: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /library/metadata/{key}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("key") {
+		case "1":
+			_, _ = w.Write([]byte(`{"MediaContainer":{"Metadata":[{"ratingKey":"1","type":"movie","librarySectionID":5}]}}`))
+		case "2":
+			_, _ = w.Write([]byte(`{"MediaContainer":{"librarySectionID":6,"Metadata":[{"ratingKey":"2","type":"episode"}]}}`))
+		case "3":
+			_, _ = w.Write([]byte(`{"MediaContainer":{"Metadata":[{"ratingKey":"3","type":"track","librarySectionID":7}]}}`))
+		case "10", "11", "12", "13", "14", "15":
+			_, _ = fmt.Fprintf(w, `{"MediaContainer":{"Metadata":[{"ratingKey":%q,"type":"movie","librarySectionID":5}]}}`,
+				r.PathValue("key"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("PUT /library/sections/{section}/all", func(_ http.ResponseWriter, r *http.Request) {
+		es.mu.Lock()
+		defer es.mu.Unlock()
+		es.edits[r.PathValue("section")+"/"+r.URL.Query().Get("id")] = r.URL.Query()
+	})
+
+	return newFakeConnection(t, mux), es
+}
+
+func (es *editServer) edit(key string) url.Values {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.edits[key]
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestPlex_EditMetadata(t *testing.T) {
+	conn, es := newEditConnection(t)
+	movie := &library.Movie{RatingKey: "1", Title: "Old", Year: 1999}
+	conn.Libraries = library.Libraries{{Movies: library.Movies{movie}}}
+	changes := make(chan ChangeEvent, 1)
+	conn.OnChange(func(e ChangeEvent) { changes <- e })
+
+	err := conn.EditMetadata(context.Background(), "1", MetadataEdit{
+		Title:     ptr("New"),
+		TitleSort: ptr("New, The"),
+		Year:      ptr(2001),
+		Lock:      true,
+		Unlock:    []MetadataField{FieldSummary},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := es.edit("5/1")
+	if q == nil {
+		t.Fatal("edit not sent to the library section of the movie")
+	}
+	if q.Get("type") != "1" || q.Get("title.value") != "New" || q.Get("title.locked") != "1" ||
+		q.Get("titleSort.value") != "New, The" || q.Get("year.value") != "2001" || q.Get("summary.locked") != "0" {
+		t.Fatalf("unexpected edit: %v", q)
+	}
+	if q.Has("summary.value") || q.Has("contentRating.value") {
+		t.Fatalf("unchanged fields sent: %v", q)
+	}
+	if movie.Title != "New" || movie.Year != 2001 {
+		t.Fatalf("library not updated: %+v", movie)
+	}
+
+	select {
+	case e := <-changes:
+		if e.Type != ChangeEdit || e.Movie != movie || e.Fields["title"] != "New" {
+			t.Fatalf("unexpected change: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change not published")
+	}
+}
+
+func TestPlex_EditMetadataBatch(t *testing.T) {
+	conn, es := newEditConnection(t)
+	movies := library.Movies{{RatingKey: "1"}}
+	edits := []BatchEdit{
+		{RatingKey: "1", Edit: MetadataEdit{ContentRating: ptr("PG")}},
+		{RatingKey: "2", Edit: MetadataEdit{Title: ptr("Pilot")}},
+		{RatingKey: "3", Edit: MetadataEdit{Title: ptr("Track")}},
+		{RatingKey: "4", Edit: MetadataEdit{Title: ptr("Gone")}},
+	}
+	for key := 10; key <= 15; key++ {
+		rk := strconv.Itoa(key)
+		movies = append(movies, &library.Movie{RatingKey: rk})
+		edits = append(edits, BatchEdit{RatingKey: rk, Edit: MetadataEdit{Title: ptr("Movie " + rk)}})
+	}
+	episode := &library.Episode{RatingKey: "2"}
+	conn.Libraries = library.Libraries{
+		{Movies: movies},
+		{Shows: library.Shows{{RatingKey: "20", Seasons: library.Seasons{1: {Episodes: library.Episodes{1: episode}}}}}},
+	}
+
+	err := conn.EditMetadataBatch(context.Background(), edits)
+	if err == nil {
+		t.Fatal("expected the errors of the track and the missing item")
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing item error not kept: %v", err)
+	}
+
+	if q := es.edit("5/1"); q.Get("contentRating.value") != "PG" || q.Has("contentRating.locked") {
+		t.Fatalf("unexpected movie edit: %v", q)
+	}
+	if q := es.edit("6/2"); q.Get("type") != "4" || q.Get("title.value") != "Pilot" {
+		t.Fatalf("unexpected episode edit: %v", q)
+	}
+	if q := es.edit("7/3"); q != nil {
+		t.Fatalf("track edited: %v", q)
+	}
+
+	// every edit that went through is in the library, however the workers finished
+	if movies[0].ContentRating != "PG" || episode.Title != "Pilot" {
+		t.Fatalf("library not updated: movie %+v, episode %+v", movies[0], episode)
+	}
+	for _, m := range movies[1:] {
+		if m.Title != "Movie "+m.RatingKey {
+			t.Fatalf("library not updated: %+v", m)
+		}
+	}
+}
+
+func TestPlex_EditMetadataNothing(t *testing.T) {
+	conn, _ := newEditConnection(t)
+
+	if err := conn.EditMetadata(context.Background(), "1", MetadataEdit{}); err == nil {
+		t.Fatal("expected an error for an empty edit")
+	}
+	if err := conn.EditMetadata(context.Background(), "", MetadataEdit{Title: ptr("x")}); err == nil {
+		t.Fatal("expected an error without ratingKey")
+	}
+}
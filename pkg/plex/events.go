@@ -0,0 +1,269 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrEventOverflow ends an event stream using OverflowError whose reader fell behind.
+var ErrEventOverflow = errors.New("event stream buffer overflowed")
+
+// EventSource tells where an Event came from.
+type EventSource int
+
+const (
+	SourceNotification EventSource = iota
+	SourceWebhook
+	// SourcePlayback are the PlaybackEvents correlated from both other sources.
+	SourcePlayback
+	// SourceChange are the changes this client made to items on the server.
+	SourceChange
+)
+
+func (s EventSource) String() string {
+	switch s {
+	case SourceNotification:
+		return "notification"
+	case SourceWebhook:
+		return "webhook"
+	case SourcePlayback:
+		return "playback"
+	case SourceChange:
+		return "change"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is one websocket notification, webhook payload, playback change or item change. Depending on the Source
+// either Notification, Webhook, Playback or Change is set. Err is only set on the last event of a stream ended by
+// OverflowError.
+type Event struct {
+	Source EventSource
+	// Type is the notification type, the webhook event name or the playback state, like playing or media.play.
+	Type     string
+	Received time.Time
+
+	Notification *NotificationContainer
+	Webhook      *WebhookEvent
+	Playback     *PlaybackEvent
+	Change       *ChangeEvent
+
+	Err error
+}
+
+// EventFilter selects the events of a stream, a nil filter selects every event.
+type EventFilter func(e Event) bool
+
+// OverflowPolicy decides what happens to a new event when the buffer of a stream is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest buffered event to make room for the new one.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowBlock waits for the reader. Events pile up in the subscriber queue meanwhile and are dropped once that
+	// is full too.
+	OverflowBlock
+	// OverflowError ends the stream with an event carrying ErrEventOverflow.
+	OverflowError
+)
+
+type EventsOptions func(*eventsConfig)
+
+type eventsConfig struct {
+	buffer   int
+	overflow OverflowPolicy
+}
+
+// WithEventBuffer sets how many events the stream buffers for its reader, sizes below one use the default.
+func WithEventBuffer(size int) EventsOptions {
+	return func(c *eventsConfig) {
+		c.buffer = size
+	}
+}
+
+// WithOverflowPolicy sets what happens when the buffer of the stream is full, the default is OverflowDropOldest.
+func WithOverflowPolicy(policy OverflowPolicy) EventsOptions {
+	return func(c *eventsConfig) {
+		c.overflow = policy
+	}
+}
+
+// Events streams the websocket notifications, webhook payloads, playback changes and item changes that filter
+// selects until ctx is canceled or the client is closed, the channel is closed afterwards. Webhook payloads are only
+// included when Webhook is set before calling Events, notifications only arrive after SubscribeToNotifications.
+func (p *Plex) Events(ctx context.Context, filter EventFilter, opts ...EventsOptions) <-chan Event {
+	cfg := eventsConfig{
+		buffer:   defaultQueueSize,
+		overflow: OverflowDropOldest,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.buffer < 1 {
+		cfg.buffer = defaultQueueSize
+	}
+
+	size := cfg.buffer
+	if cfg.overflow == OverflowError {
+		// room for the error event behind a full buffer
+		size++
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &eventStream{
+		ctx:      ctx,
+		cancel:   cancel,
+		filter:   filter,
+		buffer:   cfg.buffer,
+		overflow: cfg.overflow,
+		mu:       sync.Mutex{},
+		closed:   false,
+		out:      make(chan Event, size),
+	}
+
+	unsubscribe := []func(){
+		p.Websocket.notifications.subscribe(func(n NotificationContainer) {
+			s.send(Event{
+				Source:       SourceNotification,
+				Type:         n.Type,
+				Received:     time.Now(),
+				Notification: &n,
+				Webhook:      nil,
+				Playback:     nil,
+				Change:       nil,
+				Err:          nil,
+			})
+		}, nil),
+	}
+	unsubscribe = append(unsubscribe, p.playback.events.subscribe(func(e PlaybackEvent) {
+		s.send(Event{
+			Source:       SourcePlayback,
+			Type:         string(e.State),
+			Received:     e.Received,
+			Notification: nil,
+			Webhook:      nil,
+			Playback:     &e,
+			Change:       nil,
+			Err:          nil,
+		})
+	}, nil))
+	unsubscribe = append(unsubscribe, p.changes.subscribe(func(e ChangeEvent) {
+		s.send(Event{
+			Source:       SourceChange,
+			Type:         string(e.Type),
+			Received:     e.Applied,
+			Notification: nil,
+			Webhook:      nil,
+			Playback:     nil,
+			Change:       &e,
+			Err:          nil,
+		})
+	}, nil))
+	if p.Webhook != nil {
+		unsubscribe = append(unsubscribe, p.Webhook.payloads.subscribe(func(w WebhookEvent) {
+			s.send(Event{
+				Source:       SourceWebhook,
+				Type:         w.Event,
+				Received:     time.Now(),
+				Notification: nil,
+				Webhook:      &w,
+				Playback:     nil,
+				Change:       nil,
+				Err:          nil,
+			})
+		}, nil))
+	}
+
+	stop := context.AfterFunc(p.ctx, cancel)
+	context.AfterFunc(ctx, func() {
+		stop()
+		for _, u := range unsubscribe {
+			u()
+		}
+		s.close()
+	})
+
+	return s.out
+}
+
+// eventStream hands events from the subscriber goroutines to the reader of the channel.
+type eventStream struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	filter   EventFilter
+	buffer   int
+	overflow OverflowPolicy
+
+	// mu serializes the senders so buffer checks hold until the send and nothing is sent after close.
+	mu     sync.Mutex
+	closed bool
+	out    chan Event
+}
+
+func (s *eventStream) send(e Event) {
+	if s.filter != nil && !s.filter(e) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	switch s.overflow {
+	case OverflowBlock:
+		// the ctx is canceled before close takes the lock, so this cannot hold it forever
+		select {
+		case s.out <- e:
+		case <-s.ctx.Done():
+		}
+	case OverflowError:
+		if len(s.out) < s.buffer {
+			s.out <- e
+			return
+		}
+		s.out <- Event{
+			Source:       e.Source,
+			Type:         e.Type,
+			Received:     e.Received,
+			Notification: nil,
+			Webhook:      nil,
+			Playback:     nil,
+			Change:       nil,
+			Err:          ErrEventOverflow,
+		}
+		s.closeLocked()
+		s.cancel()
+	default:
+		for {
+			select {
+			case s.out <- e:
+				return
+			default:
+			}
+			select {
+			case <-s.out:
+			default:
+			}
+		}
+	}
+}
+
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeLocked()
+}
+
+func (s *eventStream) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		close(s.out)
+	}
+}
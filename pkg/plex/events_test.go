@@ -0,0 +1,151 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newEventsConnection(t *testing.T) *Plex {
+	t.Helper()
+	conn, err := New("http://127.0.0.1:32400", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Webhook = NewWebhook(0)
+	return conn
+}
+
+func playingNotification(sessionKey int) []byte {
+	return []byte(`{"NotificationContainer":{"type":"playing","size":1,"PlaySessionStateNotification":[` +
+		`{"sessionKey":"` + strconv.Itoa(sessionKey) + `","state":"playing"}]}}`)
+}
+
+func postWebhook(t *testing.T, wh *Webhook, payload string) {
+	t.Helper()
+	wh.handler(httptest.NewRecorder(), webhookRequest(t, "/", payload))
+}
+
+func receive(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("event stream closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+func onlyNotifications(e Event) bool {
+	return e.Source == SourceNotification
+}
+
+func TestPlex_Events(t *testing.T) {
+	conn := newEventsConnection(t)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := conn.Events(ctx, func(e Event) bool {
+		return e.Source != SourcePlayback && e.Type != "status"
+	})
+
+	if err := conn.Websocket.dispatch([]byte(`{"NotificationContainer":{"type":"status","size":0}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Websocket.dispatch(playingNotification(1)); err != nil {
+		t.Fatal(err)
+	}
+	e := receive(t, events)
+	if e.Source != SourceNotification || e.Type != "playing" || e.Notification == nil ||
+		e.Notification.PlaySessionStateNotification[0].SessionKey != "1" {
+		t.Fatalf("unexpected notification event %+v", e)
+	}
+
+	postWebhook(t, conn.Webhook, `{"event":"media.play","Metadata":{"ratingKey":"42"}}`)
+	e = receive(t, events)
+	if e.Source != SourceWebhook || e.Type != "media.play" || e.Webhook == nil || e.Webhook.Metadata.RatingKey != "42" {
+		t.Fatalf("unexpected webhook event %+v", e)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected no further events")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream not closed after cancel")
+	}
+}
+
+func TestPlex_EventsDropOldest(t *testing.T) {
+	conn := newEventsConnection(t)
+	defer conn.Close()
+	events := conn.Events(context.Background(), onlyNotifications, WithEventBuffer(2))
+
+	for i := range 5 {
+		if err := conn.Websocket.dispatch(playingNotification(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// waits until every event reached the stream
+	conn.Websocket.close()
+
+	keys := []string{
+		receive(t, events).Notification.PlaySessionStateNotification[0].SessionKey,
+		receive(t, events).Notification.PlaySessionStateNotification[0].SessionKey,
+	}
+	if keys[0] != "3" || keys[1] != "4" {
+		t.Fatalf("expected the two newest events, got %v", keys)
+	}
+}
+
+func TestPlex_EventsOverflowError(t *testing.T) {
+	conn := newEventsConnection(t)
+	defer conn.Close()
+	events := conn.Events(context.Background(), onlyNotifications, WithEventBuffer(1), WithOverflowPolicy(OverflowError))
+
+	for i := range 3 {
+		if err := conn.Websocket.dispatch(playingNotification(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Websocket.close()
+
+	if e := receive(t, events); e.Err != nil || e.Notification == nil {
+		t.Fatalf("expected the first event, got %+v", e)
+	}
+	if e := receive(t, events); !errors.Is(e.Err, ErrEventOverflow) {
+		t.Fatalf("expected ErrEventOverflow, got %+v", e)
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("expected the stream to be closed after the overflow")
+	}
+}
+
+func TestPlex_EventsBlock(t *testing.T) {
+	conn := newEventsConnection(t)
+	defer conn.Close()
+	events := conn.Events(context.Background(), onlyNotifications, WithEventBuffer(1), WithOverflowPolicy(OverflowBlock))
+
+	const sent = 5
+	for i := range sent {
+		if err := conn.Websocket.dispatch(playingNotification(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range sent {
+		e := receive(t, events)
+		if key := e.Notification.PlaySessionStateNotification[0].SessionKey; key != strconv.Itoa(i) {
+			t.Fatalf("expected session %d, got %s", i, key)
+		}
+	}
+}
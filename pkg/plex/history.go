@@ -0,0 +1,145 @@
+package plex
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kjbreil/go-plex/internal/plex/api"
+)
+
+// defaultHistoryPageSize is the number of entries requested at once when HistoryQuery.Limit is not set.
+const defaultHistoryPageSize = 100
+
+// HistoryQuery selects entries of the playback history, the zero value selects all of them, newest first.
+type HistoryQuery struct {
+	// AccountID only returns the playbacks of this account.
+	AccountID int
+	// LibrarySectionID only returns the playbacks of items in this library.
+	LibrarySectionID string
+	// RatingKey only returns the playbacks of this item.
+	RatingKey string
+	// Since and Until limit the time the items were watched, both inclusive.
+	Since time.Time
+	Until time.Time
+	// Offset skips the first entries, Limit is the number of entries GetHistory returns and the page size of
+	// History, zero means 100.
+	Offset int
+	Limit  int
+}
+
+// HistoryEntry is one playback in the history of the server.
+type HistoryEntry struct {
+	HistoryKey       string
+	RatingKey        string
+	Key              string
+	Type             string
+	Title            string
+	ParentTitle      string
+	GrandparentTitle string
+	Index            int64
+	ParentIndex      int64
+	LibrarySectionID string
+	AccountID        int
+	DeviceID         int
+	ViewedAt         time.Time
+
+	// LibraryItem is the watched item.
+	LibraryItem
+}
+
+// GetHistory returns one page of the playback history.
+func (p *Plex) GetHistory(ctx context.Context, q HistoryQuery) ([]HistoryEntry, error) {
+	resp, err := get[api.History](ctx, p, "/status/sessions/history/all", q.values())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]HistoryEntry, len(resp.MediaContainer.Metadata))
+	for i, m := range resp.MediaContainer.Metadata {
+		entries[i] = newHistoryEntry(m)
+		entries[i].LibraryItem = p.findItem(m.RatingKey)
+	}
+
+	return entries, nil
+}
+
+// History iterates over all entries the query selects, starting at q.Offset and requesting q.Limit entries at a
+// time. The iteration stops after the first error.
+func (p *Plex) History(ctx context.Context, q HistoryQuery) iter.Seq2[HistoryEntry, error] {
+	if q.Limit <= 0 {
+		q.Limit = defaultHistoryPageSize
+	}
+
+	return func(yield func(HistoryEntry, error) bool) {
+		for {
+			entries, err := p.GetHistory(ctx, q)
+			if err != nil {
+				yield(HistoryEntry{}, err)
+				return
+			}
+
+			for _, e := range entries {
+				if !yield(e, nil) {
+					return
+				}
+			}
+
+			if len(entries) < q.Limit {
+				return
+			}
+			q.Offset += len(entries)
+		}
+	}
+}
+
+func (q *HistoryQuery) values() url.Values {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultHistoryPageSize
+	}
+
+	query := url.Values{}
+	query.Set("sort", "viewedAt:desc")
+	query.Set("X-Plex-Container-Start", strconv.Itoa(q.Offset))
+	query.Set("X-Plex-Container-Size", strconv.Itoa(limit))
+	if q.AccountID != 0 {
+		query.Set("accountID", strconv.Itoa(q.AccountID))
+	}
+	if q.LibrarySectionID != "" {
+		query.Set("librarySectionID", q.LibrarySectionID)
+	}
+	if q.RatingKey != "" {
+		query.Set("metadataItemID", q.RatingKey)
+	}
+	// the = between key and value completes the operators to >= and <=
+	if !q.Since.IsZero() {
+		query.Set("viewedAt>", strconv.FormatInt(q.Since.Unix(), 10))
+	}
+	if !q.Until.IsZero() {
+		query.Set("viewedAt<", strconv.FormatInt(q.Until.Unix(), 10))
+	}
+
+	return query
+}
+
+func newHistoryEntry(m api.HistoryItem) HistoryEntry {
+	return HistoryEntry{
+		HistoryKey:       m.HistoryKey,
+		RatingKey:        m.RatingKey,
+		Key:              m.Key,
+		Type:             m.Type,
+		Title:            m.Title,
+		ParentTitle:      m.ParentTitle,
+		GrandparentTitle: m.GrandparentTitle,
+		Index:            m.Index,
+		ParentIndex:      m.ParentIndex,
+		LibrarySectionID: m.LibrarySectionID.String(),
+		AccountID:        m.AccountID,
+		DeviceID:         m.DeviceID,
+		ViewedAt:         time.Unix(m.ViewedAt, 0),
+		LibraryItem:      LibraryItem{},
+	}
+}
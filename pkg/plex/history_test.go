@@ -0,0 +1,135 @@
+package plex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+// historyServer serves a history of total movie playbacks and records the queries.
+type historyServer struct {
+	total int
+
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func (hs *historyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	hs.mu.Lock()
+	hs.queries = append(hs.queries, query)
+	hs.mu.Unlock()
+
+	start, _ := strconv.Atoi(query.Get("X-Plex-Container-Start"))
+	size, _ := strconv.Atoi(query.Get("X-Plex-Container-Size"))
+
+	items := []map[string]any{}
+	for i := start; i < min(start+size, hs.total); i++ {
+		items = append(items, map[string]any{
+			"historyKey":       fmt.Sprintf("/status/sessions/history/%d", i),
+			"ratingKey":        strconv.Itoa(i),
+			"librarySectionID": "1",
+			"title":            fmt.Sprintf("Movie %d", i),
+			"type":             "movie",
+			"viewedAt":         1700000000 - i,
+			"accountID":        1,
+			"deviceID":         2,
+		})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"MediaContainer": map[string]any{
+		"size": len(items), "totalSize": hs.total, "Metadata": items,
+	}})
+}
+
+func (hs *historyServer) requests() []url.Values {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.queries
+}
+
+func TestPlex_GetHistory(t *testing.T) {
+	hs := &historyServer{total: 5}
+	conn := newFakeConnection(t, hs)
+	movie := &library.Movie{RatingKey: "1", Title: "Movie 1"}
+	conn.Libraries = library.Libraries{{Movies: library.Movies{movie}}}
+
+	since := time.Unix(1600000000, 0)
+	entries, err := conn.GetHistory(context.Background(), HistoryQuery{
+		AccountID:        1,
+		LibrarySectionID: "1",
+		Since:            since,
+		Limit:            10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 entries, got %d", len(entries))
+	}
+	if entries[1].Movie != movie || entries[0].Movie != nil {
+		t.Fatalf("entries not joined to the library: %+v", entries[:2])
+	}
+	if entries[1].ViewedAt.Unix() != 1699999999 || entries[1].AccountID != 1 || entries[1].LibrarySectionID != "1" {
+		t.Fatalf("unexpected entry: %+v", entries[1])
+	}
+
+	query := hs.requests()[0]
+	if query.Get("accountID") != "1" || query.Get("librarySectionID") != "1" ||
+		query.Get("viewedAt>") != "1600000000" || query.Has("viewedAt<") || query.Has("metadataItemID") {
+		t.Fatalf("unexpected query: %v", query)
+	}
+}
+
+func TestPlex_History(t *testing.T) {
+	hs := &historyServer{total: 25}
+	conn := newFakeConnection(t, hs)
+
+	q := HistoryQuery{Limit: 10}
+	var keys []string
+	for e, err := range conn.History(context.Background(), q) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, e.RatingKey)
+	}
+	if len(keys) != 25 || keys[0] != "0" || keys[24] != "24" {
+		t.Fatalf("unexpected entries: %v", keys)
+	}
+	if n := len(hs.requests()); n != 3 {
+		t.Fatalf("expected 3 pages, got %d", n)
+	}
+
+	// stopping early must not request further pages
+	hs = &historyServer{total: 25}
+	conn = newFakeConnection(t, hs)
+	for range conn.History(context.Background(), q) {
+		break
+	}
+	if n := len(hs.requests()); n != 1 {
+		t.Fatalf("expected 1 page, got %d", n)
+	}
+}
+
+func TestPlex_HistoryError(t *testing.T) {
+	conn := newFakeConnection(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	var errs int
+	for _, err := range conn.History(context.Background(), HistoryQuery{}) {
+		if err != nil {
+			errs++
+		}
+	}
+	if errs != 1 {
+		t.Fatalf("expected one error, got %d", errs)
+	}
+}
@@ -13,11 +13,28 @@ import (
 
 const PlexURL = "https://plex.tv"
 
-func get[T any](p *Plex, pa string, query url.Values) (T, error) {
-	return getHost[T](p, p.url.String(), pa, query)
+// StatusError is returned when a server responds with an unexpected HTTP status.
+type StatusError struct {
+	StatusCode int
+	Status     string
 }
 
-func getHost[T any](p *Plex, host string, pa string, query url.Values) (T, error) {
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+func newStatusError(resp *http.Response) error {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+}
+
+func get[T any](ctx context.Context, p *Plex, pa string, query url.Values) (T, error) {
+	return getHost[T](ctx, p, p.url.String(), pa, query)
+}
+
+func getHost[T any](ctx context.Context, p *Plex, host string, pa string, query url.Values) (T, error) {
 	var rtn T
 
 	u, err := url.Parse(host)
@@ -27,11 +44,11 @@ func getHost[T any](p *Plex, host string, pa string, query url.Values) (T, error
 	u.Path = path.Join(u.Path, pa)
 	u.RawQuery = query.Encode()
 
-	req, reqErr := http.NewRequestWithContext(context.Background(), http.MethodGet, u.String(), nil)
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if reqErr != nil {
 		return rtn, reqErr
 	}
-	req.Header = p.defaultHeaders
+	req.Header = p.defaultHeaders.Clone()
 
 	resp, err := p.httpClient.Do(req)
 	if err != nil {
@@ -42,7 +59,7 @@ func getHost[T any](p *Plex, host string, pa string, query url.Values) (T, error
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return rtn, errors.New(resp.Status)
+		return rtn, newStatusError(resp)
 	}
 
 	err = json.NewDecoder(resp.Body).Decode(&rtn)
@@ -56,18 +73,47 @@ func getHost[T any](p *Plex, host string, pa string, query url.Values) (T, error
 	return rtn, nil
 }
 
-func postHost(p *Plex, host string, pa string, body []byte) error {
+func put(ctx context.Context, p *Plex, pa string, query url.Values) error {
+	u, err := url.Parse(p.url.String())
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, pa)
+	u.RawQuery = query.Encode()
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), nil)
+	if reqErr != nil {
+		return reqErr
+	}
+	req.Header = p.defaultHeaders.Clone()
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return newStatusError(resp)
+	}
+
+	return nil
+}
+
+func postHost(ctx context.Context, p *Plex, host string, pa string, body []byte) error {
 	u, err := url.Parse(host)
 	if err != nil {
 		return err
 	}
-	u.Path = path.Join(p.url.Path, pa)
+	u.Path = path.Join(u.Path, pa)
 
-	req, reqErr := http.NewRequestWithContext(context.Background(), http.MethodPost, u.String(), bytes.NewBuffer(body))
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewBuffer(body))
 	if reqErr != nil {
 		return reqErr
 	}
-	req.Header = p.defaultHeaders
+	req.Header = p.defaultHeaders.Clone()
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := p.httpClient.Do(req)
@@ -79,7 +125,7 @@ func postHost(p *Plex, host string, pa string, body []byte) error {
 	}()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return errors.New(resp.Status)
+		return newStatusError(resp)
 	}
 
 	return nil
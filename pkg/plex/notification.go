@@ -1,9 +1,12 @@
 package plex
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"time"
 
 	"github.com/coder/websocket"
@@ -13,47 +16,341 @@ import (
 // NotificationContainer is an alias for the internal notification container type.
 type NotificationContainer = notification.Container
 
-// NotificationEvents hold callbacks that correspond to notifications.
+// Aliases for the notifications carried by a NotificationContainer.
+type (
+	PlaySessionStateNotification               = notification.PlaySessionStateNotification
+	TimelineEntry                              = notification.TimelineEntry
+	ReachabilityNotification                   = notification.ReachabilityNotification
+	TranscodeSession                           = notification.TranscodeSession
+	Setting                                    = notification.Setting
+	BackgroundProcessingQueueEventNotification = notification.BackgroundProcessingQueueEventNotification
+	StatusNotification                         = notification.StatusNotification
+	AccountUpdateNotification                  = notification.AccountUpdateNotification
+	ProgressNotification                       = notification.ProgressNotification
+	ActivityNotification                       = notification.ActivityNotification
+	AutoUpdateNotification                     = notification.AutoUpdateNotification
+)
+
+// NotificationEvents hold callbacks that correspond to notifications. Any number of handlers can be registered, at
+// any time, and every registration returns a function that removes the handler again. Each handler runs on its own
+// goroutine with a bounded queue, a handler that falls behind misses notifications instead of blocking the others.
 type NotificationEvents struct {
-	events map[string]EventHandler
+	notifications subscribers[NotificationContainer]
+	unknown       subscribers[unknownNotification]
+	states        subscribers[connectionStateChange]
+	logger        *slog.Logger
 }
 
 // NewNotificationEvents initializes the event callbacks.
 func NewNotificationEvents() *NotificationEvents {
 	return &NotificationEvents{
-		events: make(map[string]EventHandler),
+		notifications: subscribers[NotificationContainer]{},
+		unknown:       subscribers[unknownNotification]{},
+		states:        subscribers[connectionStateChange]{},
+		logger:        slog.Default(),
 	}
 }
 
 type EventHandler func(n NotificationContainer)
 
+type unknownNotification struct {
+	notificationType string
+	raw              json.RawMessage
+}
+
+type connectionStateChange struct {
+	state ConnectionState
+	err   error
+}
+
+// SetQueueSize sets how many notifications the handlers registered afterwards can fall behind before notifications
+// are dropped for them.
+func (e *NotificationEvents) SetQueueSize(size int) {
+	e.notifications.setQueueSize(size)
+	e.unknown.setQueueSize(size)
+	e.states.setQueueSize(size)
+}
+
+// on registers fn for every item that items extracts from the notifications of the given types.
+func on[T any](e *NotificationEvents, items func(n *NotificationContainer) []T, fn func(T), types ...string) func() {
+	return e.notifications.subscribe(func(n NotificationContainer) {
+		for _, item := range items(&n) {
+			fn(item)
+		}
+	}, func(n NotificationContainer) bool {
+		return slices.Contains(types, n.Type)
+	})
+}
+
 // OnPlaying shows state information (resume, stop, pause) on a user consuming media in plex.
-func (e *NotificationEvents) OnPlaying(fn func(n NotificationContainer)) {
-	e.events["playing"] = fn
+func (e *NotificationEvents) OnPlaying(fn func(n PlaySessionStateNotification)) func() {
+	return on(e, func(n *NotificationContainer) []PlaySessionStateNotification {
+		return n.PlaySessionStateNotification
+	}, fn, "playing")
+}
+
+// OnTimeline handles library timeline entries, sent when items are added, changed or removed.
+func (e *NotificationEvents) OnTimeline(fn func(n TimelineEntry)) func() {
+	return on(e, func(n *NotificationContainer) []TimelineEntry { return n.TimelineEntry }, fn, "timeline")
+}
+
+// OnReachability handles changes of the remote access reachability of the server.
+func (e *NotificationEvents) OnReachability(fn func(n ReachabilityNotification)) func() {
+	return on(e, func(n *NotificationContainer) []ReachabilityNotification {
+		return n.ReachabilityNotification
+	}, fn, "reachability")
 }
 
 // OnTranscodeUpdate shows transcode information when a transcoding stream changes parameters.
-func (e *NotificationEvents) OnTranscodeUpdate(fn func(n NotificationContainer)) {
-	e.events["transcodeSession.update"] = fn
+func (e *NotificationEvents) OnTranscodeUpdate(fn func(n TranscodeSession)) func() {
+	return on(e, func(n *NotificationContainer) []TranscodeSession {
+		return n.TranscodeSession
+	}, fn, "transcodeSession.update")
+}
+
+// OnTranscodeEnd handles the end of a transcode session.
+func (e *NotificationEvents) OnTranscodeEnd(fn func(n TranscodeSession)) func() {
+	return on(e, func(n *NotificationContainer) []TranscodeSession {
+		return n.TranscodeSession
+	}, fn, "transcodeSession.end", "transcode.end")
+}
+
+// OnPreference handles changes of server settings.
+func (e *NotificationEvents) OnPreference(fn func(n Setting)) func() {
+	return on(e, func(n *NotificationContainer) []Setting { return n.Setting }, fn, "preference")
+}
+
+// OnBackgroundProcessingQueue handles events of the background processing queue, such as optimize jobs.
+func (e *NotificationEvents) OnBackgroundProcessingQueue(fn func(n BackgroundProcessingQueueEventNotification)) func() {
+	return on(e, func(n *NotificationContainer) []BackgroundProcessingQueueEventNotification {
+		return n.BackgroundProcessingQueueEventNotification
+	}, fn, "backgroundProcessingQueue")
+}
+
+// OnStatus handles server status notifications, such as library scans starting and finishing.
+func (e *NotificationEvents) OnStatus(fn func(n StatusNotification)) func() {
+	return on(e, func(n *NotificationContainer) []StatusNotification { return n.StatusNotification }, fn, "status")
+}
+
+// OnAccount handles changes of the accounts on the server.
+func (e *NotificationEvents) OnAccount(fn func(n AccountUpdateNotification)) func() {
+	return on(e, func(n *NotificationContainer) []AccountUpdateNotification {
+		return n.AccountUpdateNotification
+	}, fn, "account")
+}
+
+// OnProgress handles progress messages of long running server tasks.
+func (e *NotificationEvents) OnProgress(fn func(n ProgressNotification)) func() {
+	return on(e, func(n *NotificationContainer) []ProgressNotification { return n.ProgressNotification }, fn, "progress")
 }
 
 // OnActivity handles activity notifications.
-func (e *NotificationEvents) OnActivity(fn func(n NotificationContainer)) {
-	e.events["activity"] = fn
+func (e *NotificationEvents) OnActivity(fn func(n ActivityNotification)) func() {
+	return on(e, func(n *NotificationContainer) []ActivityNotification { return n.ActivityNotification }, fn, "activity")
 }
 
 // OnUpdateStateChange handles update state change notifications.
-func (e *NotificationEvents) OnUpdateStateChange(fn func(n NotificationContainer)) {
-	e.events["update.statechange"] = fn
+func (e *NotificationEvents) OnUpdateStateChange(fn func(n AutoUpdateNotification)) func() {
+	return on(e, func(n *NotificationContainer) []AutoUpdateNotification {
+		return n.AutoUpdateNotification
+	}, fn, "update.statechange")
+}
+
+// OnAny is called with every notification.
+func (e *NotificationEvents) OnAny(fn func(n NotificationContainer)) func() {
+	return e.notifications.subscribe(fn, nil)
+}
+
+// OnUnknown is called with the raw NotificationContainer of notification types this package does not know yet.
+func (e *NotificationEvents) OnUnknown(fn func(notificationType string, raw json.RawMessage)) func() {
+	return e.unknown.subscribe(func(n unknownNotification) {
+		fn(n.notificationType, n.raw)
+	}, nil)
+}
+
+// dispatch decodes a websocket message and calls the handlers registered for it.
+func (e *NotificationEvents) dispatch(message []byte) error {
+	var envelope struct {
+		Container json.RawMessage `json:"NotificationContainer"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return err
+	}
+
+	var n NotificationContainer
+	if err := json.Unmarshal(envelope.Container, &n); err != nil {
+		return err
+	}
+
+	logDropped(e.logger, e.notifications.publish(n), n.Type)
+
+	if !isKnownNotification(n.Type) {
+		logDropped(e.logger, e.unknown.publish(unknownNotification{
+			notificationType: n.Type,
+			raw:              envelope.Container,
+		}), n.Type)
+	}
+
+	return nil
+}
+
+func isKnownNotification(notificationType string) bool {
+	switch notificationType {
+	case "playing", "timeline", "reachability", "transcodeSession.update", "transcodeSession.end", "transcode.end",
+		"preference", "backgroundProcessingQueue", "status", "account", "progress", "activity", "update.statechange":
+		return true
+	default:
+		return false
+	}
+}
+
+// ConnectionState is the state of the notification websocket.
+type ConnectionState int
+
+const (
+	// StateConnected means the websocket is connected and notifications are received.
+	StateConnected ConnectionState = iota
+	// StateDisconnected means the connection was lost or closed.
+	StateDisconnected
+	// StateReconnecting means a new connection is attempted after the backoff.
+	StateReconnecting
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateReconnecting:
+		return "reconnecting"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+	pingInterval      = 10 * time.Second
+)
+
+// SubscribeOptions configure SubscribeToNotifications.
+type SubscribeOptions func(*subscribeConfig)
+
+type subscribeConfig struct {
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	syncOnReconnect bool
+}
+
+// WithReconnectBackoff sets the first and the maximum delay between reconnect attempts. The delay doubles after
+// every failed attempt.
+func WithReconnectBackoff(initial, maxBackoff time.Duration) SubscribeOptions {
+	return func(c *subscribeConfig) {
+		c.minBackoff = initial
+		c.maxBackoff = max(initial, maxBackoff)
+	}
+}
+
+// WithSyncOnReconnect runs an incremental library populate after every reconnect to pick up the changes whose
+// notifications were missed while disconnected.
+func WithSyncOnReconnect() SubscribeOptions {
+	return func(c *subscribeConfig) {
+		c.syncOnReconnect = true
+	}
+}
+
+// OnConnectionState is called whenever the websocket connects, disconnects or starts reconnecting. err holds the
+// reason of a disconnect or failed attempt, it is nil when the client is closed.
+func (e *NotificationEvents) OnConnectionState(fn func(state ConnectionState, err error)) func() {
+	return e.states.subscribe(func(c connectionStateChange) {
+		fn(c.state, c.err)
+	}, nil)
+}
+
+func (e *NotificationEvents) setState(state ConnectionState, err error) {
+	logDropped(e.logger, e.states.publish(connectionStateChange{state: state, err: err}), state.String())
+}
+
+// close stops every handler after it handled the notifications already queued for it.
+func (e *NotificationEvents) close() {
+	e.notifications.close()
+	e.unknown.close()
+	e.states.close()
 }
 
-// SubscribeToNotifications connects to your server via websockets listening for events.
-func (p *Plex) SubscribeToNotifications() {
+// SubscribeToNotifications connects to your server via websockets listening for events. The connection is
+// re-established with exponential backoff whenever it drops, until the client is closed.
+func (p *Plex) SubscribeToNotifications(opts ...SubscribeOptions) {
 	if p.url == nil {
 		p.logger.Error("cannot subscribe to notifications: no URL configured")
 		return
 	}
-	websocketURL := url.URL{Scheme: "ws", Host: p.url.Host, Path: "/:/websockets/notifications"}
+
+	cfg := subscribeConfig{
+		minBackoff:      defaultMinBackoff,
+		maxBackoff:      defaultMaxBackoff,
+		syncOnReconnect: false,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.runNotifications(cfg)
+	}()
+}
+
+// runNotifications keeps a websocket connection open until the client context is canceled.
+func (p *Plex) runNotifications(cfg subscribeConfig) {
+	backoff := cfg.minBackoff
+	connected := false
+
+	for {
+		c, err := p.dialNotifications()
+		if err == nil {
+			backoff = cfg.minBackoff
+			p.Websocket.setState(StateConnected, nil)
+			if connected && cfg.syncOnReconnect {
+				p.syncAfterReconnect()
+			}
+			connected = true
+
+			err = p.readNotifications(c)
+			if p.ctx.Err() != nil {
+				p.Websocket.setState(StateDisconnected, nil)
+				return
+			}
+			p.logger.Error("websocket connection lost", "err", err.Error())
+			p.Websocket.setState(StateDisconnected, err)
+		} else {
+			if p.ctx.Err() != nil {
+				return
+			}
+			p.logger.Error("could not dial websocket", "err", err.Error(), "retry", backoff)
+		}
+
+		p.Websocket.setState(StateReconnecting, err)
+
+		select {
+		case <-p.ctx.Done():
+			p.Websocket.setState(StateDisconnected, nil)
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, cfg.maxBackoff)
+	}
+}
+
+func (p *Plex) dialNotifications() (*websocket.Conn, error) {
+	scheme := "ws"
+	if p.url.Scheme == "https" {
+		scheme = "wss"
+	}
+	websocketURL := url.URL{Scheme: scheme, Host: p.url.Host, Path: "/:/websockets/notifications"}
 
 	dialOpts := &websocket.DialOptions{
 		HTTPHeader:           make(http.Header),
@@ -67,77 +364,84 @@ func (p *Plex) SubscribeToNotifications() {
 	}
 	dialOpts.HTTPHeader.Set("X-Plex-Token", p.token)
 
-	c, resp, dialErr := websocket.Dial(p.ctx, websocketURL.String(), dialOpts)
+	c, resp, err := websocket.Dial(p.ctx, websocketURL.String(), dialOpts)
 	if resp != nil && resp.Body != nil {
 		_ = resp.Body.Close()
 	}
 
-	if dialErr != nil {
-		p.logger.Error("could not dial websocket", "err", dialErr.Error())
-		return
-	}
+	return c, err
+}
+
+// readNotifications dispatches the notifications read from c until the connection fails or the client is closed.
+// Either way the connection is closed when it returns.
+func (p *Plex) readNotifications(c *websocket.Conn) error {
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		<-done
+	}()
 
-	p.wg.Add(1)
 	go func() {
-		defer func(_ *websocket.Conn, _ websocket.StatusCode, _ string) {
-			p.wg.Done()
-			_ = c.CloseNow()
-		}(c, websocket.StatusNormalClosure, "")
+		defer close(done)
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
 
 		for {
-			messageType, message, readErr := c.Read(p.ctx)
-
-			if readErr != nil {
-				if p.ctx.Err() == nil {
-					// Probably need to reconnect
-					p.logger.Error("could not read websocket", "err", readErr.Error())
-				} else {
+			select {
+			case <-ticker.C:
+				pingCtx, pingCancel := context.WithTimeout(ctx, pingInterval)
+				err := c.Ping(pingCtx)
+				pingCancel()
+				if err != nil && ctx.Err() == nil {
+					// a connection that does not answer pings is dead, unblock the reader
+					p.logger.Error("websocket ping failed", "err", err.Error())
+					_ = c.CloseNow()
 					return
 				}
+			case <-ctx.Done():
+				if p.ctx.Err() != nil {
+					// To cleanly close a connection, a client should send a close
+					// frame and wait for the server to close the connection.
+					if closeErr := c.Close(websocket.StatusNormalClosure, ""); closeErr != nil {
+						p.logger.Debug("failed to close websocket", "err", closeErr.Error())
+					}
+					return
+				}
+				_ = c.CloseNow()
+				return
 			}
+		}
+	}()
 
-			switch messageType {
-			case websocket.MessageText:
-			case websocket.MessageBinary:
-			}
-
-			var notif notification.WebsocketNotification
-
-			if unmarshalErr := json.Unmarshal(message, &notif); unmarshalErr != nil {
-				p.logger.Error("websocket convert message to json failed", "err", unmarshalErr.Error())
-				continue
-			}
+	for {
+		// the reader is stopped by closing the connection so the close handshake can complete
+		_, message, err := c.Read(context.Background())
+		if err != nil {
+			return err
+		}
 
-			if fn, ok := p.Websocket.events[notif.Type]; ok {
-				fn(notif.Container)
-			}
+		if dispatchErr := p.Websocket.dispatch(message); dispatchErr != nil {
+			p.logger.Error("websocket convert message to json failed", "err", dispatchErr.Error())
 		}
-	}()
+	}
+}
 
+// syncAfterReconnect runs an incremental populate in the background to pick up the changes missed while the
+// websocket was disconnected. Nothing is synced when the libraries were never populated.
+func (p *Plex) syncAfterReconnect() {
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
-		ticker := time.NewTicker(time.Second)
-		defer ticker.Stop()
 
-		for {
-			select {
-			case t := <-ticker.C:
-				writeErr := c.Write(p.ctx, websocket.MessageText, []byte(t.String()))
-
-				if writeErr != nil {
-					p.logger.Error("failed to write to websocket", "err", writeErr.Error())
-				}
-			case <-p.ctx.Done():
-				// To cleanly close a connection, a client should send a close
-				// frame and wait for the server to close the connection.
-				closeErr := c.Close(websocket.StatusNormalClosure, "")
+		p.populateMu.Lock()
+		populated := !p.lastPopulate.IsZero()
+		p.populateMu.Unlock()
 
-				if closeErr != nil {
-					p.logger.Error("failed to close websocket", "err", closeErr.Error())
-				}
-				return
-			}
+		if populated {
+			p.autoRefresh(p.ctx, false)
 		}
 	}()
 }
@@ -0,0 +1,336 @@
+package plex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// fakeNotificationServer sends one playing notification per connection and then drops the connection, except for
+// the last one which stays open until the client closes it.
+type fakeNotificationServer struct {
+	drops       int32
+	connections atomic.Int32
+}
+
+func (fs *fakeNotificationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer c.CloseNow()
+
+	n := fs.connections.Add(1)
+	msg := `{"NotificationContainer":{"type":"playing","size":1,` +
+		`"PlaySessionStateNotification":[{"sessionKey":"1","state":"playing"}]}}`
+	if err = c.Write(r.Context(), websocket.MessageText, []byte(msg)); err != nil {
+		return
+	}
+
+	if n <= fs.drops {
+		return
+	}
+
+	// keep reading so pings are answered and the close handshake completes
+	for {
+		if _, _, err = c.Read(r.Context()); err != nil {
+			return
+		}
+	}
+}
+
+func TestPlex_SubscribeToNotificationsReconnect(t *testing.T) {
+	fs := &fakeNotificationServer{drops: 2}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+
+	conn, err := New(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var states []ConnectionState
+	conn.Websocket.OnConnectionState(func(state ConnectionState, _ error) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+	})
+
+	received := make(chan struct{}, 10)
+	conn.Websocket.OnPlaying(func(_ PlaySessionStateNotification) {
+		received <- struct{}{}
+	})
+
+	conn.SubscribeToNotifications(WithReconnectBackoff(time.Millisecond, 10*time.Millisecond))
+
+	for i := range 3 {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notification %d not received", i+1)
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		conn.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on the websocket")
+	}
+
+	if n := fs.connections.Load(); n != 3 {
+		t.Fatalf("expected 3 connections, got %d", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []ConnectionState{
+		StateConnected, StateDisconnected, StateReconnecting,
+		StateConnected, StateDisconnected, StateReconnecting,
+		StateConnected, StateDisconnected,
+	}
+	if len(states) != len(want) {
+		t.Fatalf("expected states %v, got %v", want, states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("expected states %v, got %v", want, states)
+		}
+	}
+}
+
+func TestPlex_SubscribeToNotificationsDialRetry(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		(&fakeNotificationServer{}).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	conn, err := New(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	received := make(chan struct{}, 1)
+	conn.Websocket.OnPlaying(func(_ PlaySessionStateNotification) {
+		received <- struct{}{}
+	})
+	conn.SubscribeToNotifications(WithReconnectBackoff(time.Millisecond, time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	select {
+	case <-received:
+	case <-ctx.Done():
+		t.Fatal("no notification after the dial retries")
+	}
+}
+
+func TestPlex_SubscribeToNotificationsSyncOnReconnect(t *testing.T) {
+	fs := &fakeServer{movies: 2}
+	mux := http.NewServeMux()
+	mux.Handle("/:/websockets/notifications", &fakeNotificationServer{drops: 1})
+	mux.Handle("/", fs)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	conn, err := New(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.InitLibraries(); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.PopulateLibraries()(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SubscribeToNotifications(WithReconnectBackoff(time.Millisecond, time.Millisecond), WithSyncOnReconnect())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fs.mu.Lock()
+		n := len(fs.sectionQueries)
+		fs.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no incremental sync after the reconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNotificationEvents_Dispatch(t *testing.T) {
+	e := NewNotificationEvents()
+
+	var playing []PlaySessionStateNotification
+	e.OnPlaying(func(n PlaySessionStateNotification) {
+		playing = append(playing, n)
+	})
+	var ended []TranscodeSession
+	e.OnTranscodeEnd(func(n TranscodeSession) {
+		ended = append(ended, n)
+	})
+	var all []string
+	e.OnAny(func(n NotificationContainer) {
+		all = append(all, n.Type)
+	})
+	var unknown []string
+	e.OnUnknown(func(notificationType string, raw json.RawMessage) {
+		unknown = append(unknown, notificationType+" "+string(raw))
+	})
+
+	messages := []string{
+		`{"NotificationContainer":{"type":"playing","size":2,"PlaySessionStateNotification":[` +
+			`{"sessionKey":"1","state":"playing"},{"sessionKey":"2","state":"paused"}]}}`,
+		`{"NotificationContainer":{"type":"transcodeSession.end","size":1,"TranscodeSession":[{"key":"/t/1"}]}}`,
+		`{"NotificationContainer":{"type":"status","size":1,"StatusNotification":[{"title":"scan"}]}}`,
+		`{"NotificationContainer":{"type":"brand.new","size":1}}`,
+	}
+	for _, m := range messages {
+		if err := e.dispatch([]byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.dispatch([]byte("not json")); err == nil {
+		t.Fatal("expected a decode error")
+	}
+	// waits for the handlers to finish
+	e.close()
+
+	if len(playing) != 2 || playing[0].SessionKey != "1" || playing[1].State != "paused" {
+		t.Fatalf("unexpected playing notifications %+v", playing)
+	}
+	if len(ended) != 1 || ended[0].Key != "/t/1" {
+		t.Fatalf("unexpected transcode notifications %+v", ended)
+	}
+	if len(all) != 4 {
+		t.Fatalf("expected OnAny for every notification, got %v", all)
+	}
+	if len(unknown) != 1 || unknown[0] != `brand.new {"type":"brand.new","size":1}` {
+		t.Fatalf("unexpected unknown notifications %v", unknown)
+	}
+}
+
+const playingMessage = `{"NotificationContainer":{"type":"playing","size":1,` +
+	`"PlaySessionStateNotification":[{"sessionKey":"1","state":"playing"}]}}`
+
+func TestNotificationEvents_MultipleSubscribers(t *testing.T) {
+	e := NewNotificationEvents()
+
+	var first, second atomic.Int32
+	unsubscribe := e.OnPlaying(func(_ PlaySessionStateNotification) {
+		first.Add(1)
+	})
+	e.OnPlaying(func(_ PlaySessionStateNotification) {
+		second.Add(1)
+	})
+
+	if err := e.dispatch([]byte(playingMessage)); err != nil {
+		t.Fatal(err)
+	}
+	unsubscribe()
+	// calling it again is a no-op
+	unsubscribe()
+	if err := e.dispatch([]byte(playingMessage)); err != nil {
+		t.Fatal(err)
+	}
+	e.close()
+
+	if first.Load() != 1 {
+		t.Fatalf("expected the unsubscribed handler to run once, ran %d times", first.Load())
+	}
+	if second.Load() != 2 {
+		t.Fatalf("expected the second handler to run twice, ran %d times", second.Load())
+	}
+
+	// registering after close does nothing and does not panic
+	e.OnPlaying(func(_ PlaySessionStateNotification) {})()
+}
+
+func TestNotificationEvents_SlowSubscriber(t *testing.T) {
+	e := NewNotificationEvents()
+	e.SetQueueSize(1)
+
+	release := make(chan struct{})
+	var slow atomic.Int32
+	e.OnPlaying(func(_ PlaySessionStateNotification) {
+		<-release
+		slow.Add(1)
+	})
+	var fast atomic.Int32
+	e.OnPlaying(func(_ PlaySessionStateNotification) {
+		fast.Add(1)
+	})
+
+	const sent = 5
+	for i := range sent {
+		if err := e.dispatch([]byte(playingMessage)); err != nil {
+			t.Fatal(err)
+		}
+		// the fast handler keeps up even though the slow one is stuck
+		deadline := time.Now().Add(time.Second)
+		for fast.Load() != int32(i+1) {
+			if time.Now().After(deadline) {
+				t.Fatalf("fast handler blocked after %d notifications", fast.Load())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(release)
+	e.close()
+
+	if fast.Load() != sent {
+		t.Fatalf("expected the fast handler to see every notification, saw %d", fast.Load())
+	}
+	// one in the handler and one queued, the rest were dropped
+	if slow.Load() >= sent {
+		t.Fatalf("expected the slow handler to miss notifications, saw %d", slow.Load())
+	}
+}
+
+func TestNotificationEvents_ConcurrentSubscribe(t *testing.T) {
+	e := NewNotificationEvents()
+
+	var wg sync.WaitGroup
+	var handled atomic.Int32
+	for range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			unsubscribe := e.OnAny(func(_ NotificationContainer) {
+				handled.Add(1)
+			})
+			unsubscribe()
+		}()
+		go func() {
+			defer wg.Done()
+			if err := e.dispatch([]byte(playingMessage)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	e.close()
+}
@@ -1,12 +1,25 @@
 package plex
 
-import "log/slog"
+import (
+	"log/slog"
 
+	"github.com/kjbreil/go-plex/pkg/cache"
+)
+
+// WithCacheLibrary caches the libraries in a JSON file at location.
 func WithCacheLibrary(location string) func(*Plex) {
 	return func(p *Plex) {
-		p.cacheLibrary = location
+		p.cache = cache.NewJSONFile(location)
+	}
+}
+
+// WithCache caches the libraries in c, which is closed together with the client.
+func WithCache(c cache.Cache) func(*Plex) {
+	return func(p *Plex) {
+		p.cache = c
 	}
 }
+
 func WithLogger(l *slog.Logger) func(*Plex) {
 	return func(p *Plex) {
 		p.logger = l
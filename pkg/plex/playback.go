@@ -0,0 +1,265 @@
+package plex
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+const (
+	// playbackWindow is how long after a change the other source may report the same change.
+	playbackWindow = 10 * time.Second
+	// playbackIdle drops sessions that were not reported by either source for this long.
+	playbackIdle = time.Hour
+)
+
+// PlaybackState is the state of a playback session.
+type PlaybackState string
+
+const (
+	PlaybackPlaying   PlaybackState = "playing"
+	PlaybackPaused    PlaybackState = "paused"
+	PlaybackBuffering PlaybackState = "buffering"
+	PlaybackStopped   PlaybackState = "stopped"
+)
+
+// PlaybackEvent is a change of a playback session, normalized from the websocket playing notifications and the
+// webhook media events. The fields only one source knows are filled once both reported the session, the
+// notification carries SessionKey and Offset while the webhook carries the user and the player.
+type PlaybackEvent struct {
+	// Source is the source that reported the change first.
+	Source     EventSource
+	SessionKey string
+	UserID     int
+	User       string
+	PlayerUUID string
+	Player     string
+	RatingKey  string
+	State      PlaybackState
+	Offset     time.Duration
+	Received   time.Time
+
+	// LibraryItem is the played item.
+	LibraryItem
+}
+
+// LibraryItem is an item in Libraries, if they are populated. It is either a movie, or a show with the season and
+// episode when the item is one of them.
+type LibraryItem struct {
+	Movie   *library.Movie
+	Show    *library.Show
+	Season  *library.Season
+	Episode *library.Episode
+}
+
+// OnPlayback is called once for every change of a playback session, no matter which source reported it first.
+// Webhook payloads are only taken into account after ServeWebhook.
+func (p *Plex) OnPlayback(fn func(e PlaybackEvent)) func() {
+	return p.playback.events.subscribe(fn, nil)
+}
+
+// playbackSession is what both sources reported about one playback so far.
+type playbackSession struct {
+	sessionKey string
+	userID     int
+	user       string
+	playerUUID string
+	player     string
+	ratingKey  string
+	state      PlaybackState
+	offset     time.Duration
+	// changed is when the state last changed and seen when either source last reported the session.
+	changed time.Time
+	seen    time.Time
+}
+
+// playbackBus correlates the websocket and webhook reports of the same playback and publishes the changes.
+type playbackBus struct {
+	p        *Plex
+	mu       sync.Mutex
+	sessions []*playbackSession
+	events   subscribers[PlaybackEvent]
+}
+
+func newPlaybackBus(p *Plex) *playbackBus {
+	b := &playbackBus{
+		p:        p,
+		mu:       sync.Mutex{},
+		sessions: nil,
+		events:   subscribers[PlaybackEvent]{},
+	}
+
+	p.Websocket.notifications.subscribe(func(n NotificationContainer) {
+		for _, s := range n.PlaySessionStateNotification {
+			b.notification(s)
+		}
+	}, func(n NotificationContainer) bool {
+		return n.Type == "playing"
+	})
+
+	return b
+}
+
+// attach feeds the payloads of wh to the bus.
+func (b *playbackBus) attach(wh *Webhook) {
+	wh.payloads.subscribe(b.webhook, func(w WebhookEvent) bool {
+		_, ok := webhookPlaybackState(w.Event)
+		return ok
+	})
+}
+
+func (b *playbackBus) notification(n PlaySessionStateNotification) {
+	now := time.Now()
+
+	b.mu.Lock()
+	s := b.session(now, func(s *playbackSession) bool {
+		return n.SessionKey != "" && s.sessionKey == n.SessionKey
+	}, func(s *playbackSession) bool {
+		return s.sessionKey == "" && s.ratingKey == n.RatingKey
+	})
+	s.sessionKey = n.SessionKey
+	s.offset = time.Duration(n.ViewOffset) * time.Millisecond
+	e, changed := s.change(SourceNotification, n.RatingKey, PlaybackState(n.State), now)
+	b.mu.Unlock()
+
+	if changed {
+		b.publish(e)
+	}
+}
+
+func (b *playbackBus) webhook(w WebhookEvent) {
+	state, _ := webhookPlaybackState(w.Event)
+	now := time.Now()
+
+	b.mu.Lock()
+	s := b.session(now, func(s *playbackSession) bool {
+		return w.Player.UUID != "" && s.playerUUID == w.Player.UUID
+	}, func(s *playbackSession) bool {
+		return s.playerUUID == "" && s.ratingKey == w.Metadata.RatingKey
+	})
+	s.userID = w.Account.ID
+	s.user = w.Account.Title
+	s.playerUUID = w.Player.UUID
+	s.player = w.Player.Title
+	if w.Metadata.ViewOffset > 0 {
+		s.offset = time.Duration(w.Metadata.ViewOffset) * time.Millisecond
+	}
+	e, changed := s.change(SourceWebhook, w.Metadata.RatingKey, state, now)
+	b.mu.Unlock()
+
+	if changed {
+		b.publish(e)
+	}
+}
+
+// session returns the session that match selects, or else a session the other source reported within the
+// playbackWindow that adopt selects, or else a new session. Sessions that ended are forgotten on the way.
+func (b *playbackBus) session(now time.Time, match, adopt func(s *playbackSession) bool) *playbackSession {
+	b.sessions = slices.DeleteFunc(b.sessions, func(s *playbackSession) bool {
+		idle := now.Sub(s.seen)
+		return idle > playbackIdle || (s.state == PlaybackStopped && idle > playbackWindow)
+	})
+
+	var found *playbackSession
+	for _, s := range b.sessions {
+		if match(s) {
+			found = s
+			break
+		}
+	}
+	if found == nil {
+		for _, s := range b.sessions {
+			if now.Sub(s.changed) <= playbackWindow && adopt(s) {
+				found = s
+				break
+			}
+		}
+	}
+	if found == nil {
+		found = new(playbackSession)
+		b.sessions = append(b.sessions, found)
+	}
+
+	found.seen = now
+	return found
+}
+
+// change records a report and returns the event for it when it changed the session.
+func (s *playbackSession) change(source EventSource, ratingKey string, state PlaybackState,
+	now time.Time) (PlaybackEvent, bool) {
+	if s.ratingKey == ratingKey && s.state == state {
+		return PlaybackEvent{}, false
+	}
+	s.ratingKey = ratingKey
+	s.state = state
+	s.changed = now
+
+	return PlaybackEvent{
+		Source:      source,
+		SessionKey:  s.sessionKey,
+		UserID:      s.userID,
+		User:        s.user,
+		PlayerUUID:  s.playerUUID,
+		Player:      s.player,
+		RatingKey:   s.ratingKey,
+		State:       s.state,
+		Offset:      s.offset,
+		Received:    now,
+		LibraryItem: LibraryItem{},
+	}, true
+}
+
+func (b *playbackBus) publish(e PlaybackEvent) {
+	b.p.enrichPlayback(&e)
+	logDropped(b.p.logger, b.events.publish(e), "playback")
+}
+
+func (b *playbackBus) close() {
+	b.events.close()
+}
+
+func (p *Plex) enrichPlayback(e *PlaybackEvent) {
+	e.LibraryItem = p.findItem(e.RatingKey)
+}
+
+// findItem looks an item up in Libraries. A populate changes the items in place, so the lookup is skipped while one
+// is running rather than waiting for it.
+func (p *Plex) findItem(ratingKey string) LibraryItem {
+	if ratingKey == "" || !p.libraryMu.TryRLock() {
+		return LibraryItem{}
+	}
+	defer p.libraryMu.RUnlock()
+
+	return p.lookupItem(ratingKey)
+}
+
+// lookupItem finds a movie, a show, a season with its show or an episode with its show and season, the caller holds
+// libraryMu.
+func (p *Plex) lookupItem(ratingKey string) LibraryItem {
+	if movie := p.Libraries.FindMovie(ratingKey); movie != nil {
+		return LibraryItem{Movie: movie, Show: nil, Season: nil, Episode: nil}
+	}
+	if show, season, episode := p.Libraries.FindEpisode(ratingKey); episode != nil {
+		return LibraryItem{Movie: nil, Show: show, Season: season, Episode: episode}
+	}
+	if show, season := p.Libraries.FindSeason(ratingKey); season != nil {
+		return LibraryItem{Movie: nil, Show: show, Season: season, Episode: nil}
+	}
+	return LibraryItem{Movie: nil, Show: p.Libraries.FindShow(ratingKey), Season: nil, Episode: nil}
+}
+
+// webhookPlaybackState maps the webhook events that change a playback to its new state.
+func webhookPlaybackState(event string) (PlaybackState, bool) {
+	switch event {
+	case WebhookMediaPlay, WebhookMediaResume:
+		return PlaybackPlaying, true
+	case WebhookMediaPause:
+		return PlaybackPaused, true
+	case WebhookMediaStop:
+		return PlaybackStopped, true
+	default:
+		return "", false
+	}
+}
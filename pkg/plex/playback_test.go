@@ -0,0 +1,105 @@
+package plex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+func TestPlaybackBus_Deduplicates(t *testing.T) {
+	conn := newEventsConnection(t)
+	conn.Libraries = library.Libraries{{
+		Title:  "Movies",
+		Type:   library.TypeMovie,
+		Movies: library.Movies{{Title: "Alien", RatingKey: "42"}},
+	}}
+
+	var events []PlaybackEvent
+	conn.OnPlayback(func(e PlaybackEvent) {
+		events = append(events, e)
+	})
+
+	notification := func(state string, offset int64) {
+		conn.playback.notification(PlaySessionStateNotification{
+			SessionKey: "7",
+			RatingKey:  "42",
+			State:      state,
+			ViewOffset: offset,
+		})
+	}
+	webhook := func(event string) {
+		var w WebhookEvent
+		w.Event = event
+		w.Account.ID = 1
+		w.Account.Title = "kjbreil"
+		w.Player.UUID = "player-1"
+		w.Player.Title = "Living Room"
+		w.Metadata.RatingKey = "42"
+		conn.playback.webhook(w)
+	}
+
+	notification("playing", 0)
+	webhook("media.play")
+	// periodic progress of the same state is not a change
+	notification("playing", 10000)
+	webhook("media.pause")
+	notification("paused", 12000)
+	notification("playing", 12000)
+	webhook("media.resume")
+	notification("stopped", 20000)
+	webhook("media.stop")
+
+	conn.Close()
+
+	want := []struct {
+		state  PlaybackState
+		source EventSource
+	}{
+		{PlaybackPlaying, SourceNotification},
+		{PlaybackPaused, SourceWebhook},
+		{PlaybackPlaying, SourceNotification},
+		{PlaybackStopped, SourceNotification},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		if events[i].State != w.state || events[i].Source != w.source {
+			t.Fatalf("event %d: expected %s from %s, got %s from %s", i, w.state, w.source, events[i].State,
+				events[i].Source)
+		}
+	}
+
+	// once both sources reported the session it carries what each of them knows
+	last := events[len(events)-1]
+	if last.SessionKey != "7" || last.User != "kjbreil" || last.Player != "Living Room" ||
+		last.Offset != 20*time.Second {
+		t.Fatalf("unexpected correlated event %+v", last)
+	}
+	if last.Movie == nil || last.Movie.Title != "Alien" {
+		t.Fatalf("expected the event to be enriched with the movie, got %+v", last.Movie)
+	}
+}
+
+func TestPlaybackBus_SeparatePlayers(t *testing.T) {
+	conn := newEventsConnection(t)
+
+	var events []PlaybackEvent
+	conn.OnPlayback(func(e PlaybackEvent) {
+		events = append(events, e)
+	})
+
+	for _, player := range []string{"player-1", "player-2"} {
+		var w WebhookEvent
+		w.Event = "media.play"
+		w.Player.UUID = player
+		w.Metadata.RatingKey = "42"
+		conn.playback.webhook(w)
+	}
+	conn.Close()
+
+	if len(events) != 2 || events[0].PlayerUUID == events[1].PlayerUUID {
+		t.Fatalf("expected one event per player, got %+v", events)
+	}
+}
@@ -0,0 +1,79 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// taskResult is the outcome of a single task run by runTasks.
+type taskResult[T any] struct {
+	Task T
+	Err  error
+}
+
+// runTasks runs fn for each task on at most workers goroutines. Every task gets its own result so a failure is
+// attributed to the item that caused it. The first fatal error cancels the tasks that have not finished and is
+// returned, non-fatal errors are only recorded in the results.
+func runTasks[T any](
+	ctx context.Context,
+	workers int,
+	tasks []T,
+	fn func(ctx context.Context, task T) error,
+) ([]taskResult[T], error) {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+
+	results := make([]taskResult[T], len(tasks))
+	for i, task := range tasks {
+		results[i].Task = task
+		g.Go(func() error {
+			// exit out if the context is canceled
+			if err := gctx.Err(); err != nil {
+				results[i].Err = err
+				return nil
+			}
+			err := fn(gctx, task)
+			results[i].Err = err
+			if isFatal(err) {
+				return err
+			}
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return results, err
+	}
+
+	// the group context is not canceled when only the parent is
+	return results, ctx.Err()
+}
+
+// isFatal reports whether err means there is no point in continuing with the remaining tasks.
+func isFatal(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// taskErrors joins the errors of the failed results.
+func taskErrors[T any](results []taskResult[T], wrap func(task T, err error) error) error {
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, wrap(r.Task, r.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
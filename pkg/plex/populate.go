@@ -1,88 +1,223 @@
 package plex
 
 import (
-	"log/slog"
+	"context"
+	"net/url"
+	"path"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/kjbreil/go-plex/internal/plex/api"
 	"github.com/kjbreil/go-plex/pkg/library"
 )
 
+// episodeType is the metadata type plex uses to filter a section for episodes.
+const episodeType = "4"
+
 func (p *Plex) InitLibraries() error {
 	var err error
+	p.machineIdentifier, err = p.GetMachineIdentifier()
+	if err != nil {
+		return err
+	}
+
 	p.Libraries, err = p.GetLibraries()
 	if err != nil {
 		return err
 	}
 
-	p.mergeCache()
+	// a broken cache only costs a full populate
+	if err = p.mergeCache(); err != nil {
+		p.logger.Warn("could not merge cache", "err", err.Error())
+	}
 
 	return nil
 }
 
-func (p *Plex) PopulateLibraries() func() {
-	done := make(chan struct{}, 1)
+// PopulateLibraries fetches the shows, movies and episodes of every library in the background. The returned function
+// blocks until the populate has finished and returns the error that stopped it, if any. Items that failed on their own
+// are logged and do not stop the populate.
+func (p *Plex) PopulateLibraries() func() error {
+	done := make(chan error, 1)
 
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
 
-		start := time.Now()
+		p.populateMu.Lock()
+		defer p.populateMu.Unlock()
+
+		done <- p.populateLibraries(p.ctx, time.Time{})
+	}()
 
-		buf := make(chan struct{}, bufLen)
-		wg := &sync.WaitGroup{}
+	return sync.OnceValue(func() error {
+		return <-done
+	})
+}
+
+// populateLibraries fetches every item when since is zero and removes the items that are gone from the server.
+// Otherwise only the items updated since then are fetched and nothing is removed. The caller must hold populateMu.
+func (p *Plex) populateLibraries(ctx context.Context, since time.Time) error {
+	p.lockLibraries()
+	defer p.unlockLibraries()
+
+	start := time.Now()
+	full := since.IsZero()
+
+	var query url.Values
+	if full {
+		if err := p.refreshLibraries(ctx); err != nil {
+			return err
+		}
+	} else {
+		query = url.Values{}
+		query.Set("updatedAt>>", strconv.FormatInt(since.Unix(), 10))
+	}
+
+	var shows []*library.Show
+	for _, lib := range p.Libraries {
 		var err error
-		for _, lib := range p.Libraries {
-			if lib.Type == library.TypeShow {
-				err = p.GetLibraryShows(lib, "")
-				if err != nil {
-					slog.Error("could not Get library shows", "library", lib.Title, "err", err.Error())
-					continue
-				}
-			}
-			if lib.Type == library.TypeMovie {
-				err = p.GetLibraryMovies(lib, "")
-				if err != nil {
-					slog.Error("could not Get library movies", "library", lib.Title, "err", err.Error())
-					continue
-				}
+		switch lib.Type {
+		case library.TypeShow:
+			var libShows []*library.Show
+			libShows, err = p.getLibraryShows(ctx, lib, "", query)
+			shows = append(shows, libShows...)
+			if !full && !isFatal(err) {
+				// new episodes do not update their show, look them up on their own
+				libShows, err = p.getUpdatedEpisodeShows(ctx, lib, query)
+				shows = append(shows, libShows...)
 			}
+		case library.TypeMovie:
+			err = p.getLibraryMovies(ctx, lib, "", query)
+		}
+		if isFatal(err) {
+			return err
+		}
+		if err != nil {
+			p.logger.Error("could not Get library items", "library", lib.Title, "type", lib.Type, "err", err.Error())
 		}
+	}
 
-		for _, lib := range p.Libraries {
-			if lib.Type == library.TypeShow {
-				for _, show := range lib.Shows {
-					wg.Add(1)
-					buf <- struct{}{}
-					go func(show *library.Show) {
-						defer func() {
-							<-buf
-							wg.Done()
-						}()
-						// exit out if the context is canceled
-						if p.ctx.Err() != nil {
-							return
-						}
-						err = p.GetShowEpisodes(show)
-						if err != nil {
-							slog.Error("could not Get show episodes", "show", show.Title, "err", err.Error())
-							return
-						}
-					}(show)
-				}
+	results, err := runTasks(ctx, bufLen, unique(shows), p.getShowEpisodes)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			p.logger.Error("could not Get show episodes", "show", r.Task.Title, "err", r.Err.Error())
+		}
+	}
+
+	if full {
+		p.cleanupStaleLibraries(start)
+	}
+	p.lastPopulate = start
+
+	return nil
+}
+
+// lockLibraries takes libraryMu for a populate. populating is set first, so a change either sees it and skips
+// Libraries or gets libraryMu before the populate does.
+func (p *Plex) lockLibraries() {
+	p.populatingMu.Lock()
+	p.populating = true
+	p.populatingMu.Unlock()
+
+	p.libraryMu.Lock()
+}
+
+func (p *Plex) unlockLibraries() {
+	p.populatingMu.Lock()
+	p.populating = false
+	p.populatingMu.Unlock()
+
+	p.libraryMu.Unlock()
+}
+
+// lockChange takes libraryMu for a change unless a populate holds or waits for it, it tells whether it did.
+func (p *Plex) lockChange() bool {
+	p.populatingMu.Lock()
+	defer p.populatingMu.Unlock()
+
+	if p.populating {
+		return false
+	}
+	p.libraryMu.Lock()
+	return true
+}
+
+// refreshLibraries updates the libraries from the server and adds new ones, keeping the items already fetched.
+func (p *Plex) refreshLibraries(ctx context.Context) error {
+	resp, err := get[api.LibrarySections](ctx, p, "/library/sections", nil)
+	if err != nil {
+		return err
+	}
+
+	for _, lib := range resp.MediaContainer.Directory {
+		lib.SetRefreshedAt()
+
+		var existing *library.Library
+		for _, l := range p.Libraries {
+			if l.Title == lib.Title {
+				existing = l
+				break
 			}
 		}
+		if existing == nil {
+			p.Libraries = append(p.Libraries, lib)
+			continue
+		}
 
-		wg.Wait()
+		shows, movies := existing.Shows, existing.Movies
+		*existing = *lib
+		existing.Shows, existing.Movies = shows, movies
+	}
 
-		p.cleanupStaleLibraries(start)
-		done <- struct{}{}
-	}()
+	return nil
+}
 
-	return func() {
-		<-done
-		close(done)
+// getUpdatedEpisodeShows returns the shows of lib that have episodes matching query.
+func (p *Plex) getUpdatedEpisodeShows(
+	ctx context.Context,
+	lib *library.Library,
+	query url.Values,
+) ([]*library.Show, error) {
+	episodeQuery := url.Values{}
+	for k, v := range query {
+		episodeQuery[k] = v
+	}
+	episodeQuery.Set("type", episodeType)
+
+	resp, err := get[api.SearchResults](ctx, p, path.Join("/library/sections/", lib.Key, "all"), episodeQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var shows []*library.Show
+	for _, md := range resp.MediaContainer.Metadata {
+		for _, show := range lib.Shows {
+			if show.RatingKey == md.GrandparentRatingKey {
+				shows = append(shows, show)
+				break
+			}
+		}
+	}
+
+	return shows, nil
+}
+
+// unique removes repeated pointers from items keeping the first occurrence.
+func unique[T comparable](items []T) []T {
+	seen := make(map[T]bool, len(items))
+	out := items[:0]
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			out = append(out, item)
+		}
 	}
+	return out
 }
 
 // cleanupStaleLibraries removes libraries, movies, shows, seasons, and episodes
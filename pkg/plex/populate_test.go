@@ -0,0 +1,270 @@
+package plex
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+// fakeServer is a minimal Plex Media Server with one movie library and one show library.
+type fakeServer struct {
+	movies int
+	shows  int
+	// metadataStatus lets a test fail the metadata request of a rating key, 0 means 200.
+	metadataStatus func(ratingKey string) int
+	// metadataDelay slows down every metadata request.
+	metadataDelay time.Duration
+
+	metadataRequests atomic.Int64
+
+	mu             sync.Mutex
+	sectionQueries []string
+}
+
+// newFakeConnection connects to a test server running h, like a fakeServer.
+func newFakeConnection(t *testing.T, h http.Handler) *Plex {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	conn, err := New(srv.URL, "token")
+	if err != nil {
+		t.Fatalf("failed to create plex connection: %v", err)
+	}
+	t.Cleanup(conn.Close)
+
+	return conn
+}
+
+func (fs *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.URL.Path == "/identity":
+		fs.write(w, map[string]any{"machineIdentifier": "fake-server", "claimed": true})
+	case r.URL.Path == "/library/sections":
+		fs.write(w, map[string]any{"Directory": []map[string]any{
+			{"key": "1", "title": "Movies", "type": "movie"},
+			{"key": "2", "title": "TV Shows", "type": "show"},
+		}})
+	case strings.HasPrefix(r.URL.Path, "/library/sections/") && r.URL.RawQuery != "":
+		// filtered requests come from incremental populates, nothing changed on this server
+		fs.mu.Lock()
+		fs.sectionQueries = append(fs.sectionQueries, r.URL.Query().Encode())
+		fs.mu.Unlock()
+		fs.write(w, map[string]any{"Metadata": []map[string]any{}})
+	case r.URL.Path == "/library/sections/1/all":
+		fs.write(w, map[string]any{"Metadata": fs.items("movie", 1000, fs.movies)})
+	case r.URL.Path == "/library/sections/2/all":
+		fs.write(w, map[string]any{"Metadata": fs.items("show", 2000, fs.shows)})
+	case r.URL.Path == "/:/rate":
+		// accepted, the rating shows up with the next populate
+	case len(parts) == 3 && parts[1] == "metadata":
+		fs.metadata(w, parts[2])
+	case len(parts) == 4 && parts[1] == "metadata" && parts[3] == "children":
+		fs.children(w, parts[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (fs *fakeServer) items(kind string, base, n int) []map[string]any {
+	items := make([]map[string]any, n)
+	for i := range items {
+		items[i] = fs.item(kind, strconv.Itoa(base+i), i+1)
+	}
+	return items
+}
+
+func (fs *fakeServer) item(kind string, ratingKey string, index int) map[string]any {
+	return map[string]any{
+		"ratingKey": ratingKey,
+		"guid":      "plex://" + kind + "/" + ratingKey,
+		"title":     kind + " " + ratingKey,
+		"type":      kind,
+		"index":     index,
+	}
+}
+
+func (fs *fakeServer) metadata(w http.ResponseWriter, ratingKey string) {
+	fs.metadataRequests.Add(1)
+	if fs.metadataStatus != nil {
+		if status := fs.metadataStatus(ratingKey); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	key, _ := strconv.Atoi(ratingKey)
+	// vary the response time so the workers finish out of order
+	time.Sleep(fs.metadataDelay + time.Duration(key%5)*time.Millisecond)
+
+	var item map[string]any
+	switch {
+	case key >= 4000:
+		item = fs.item("episode", ratingKey, key%10)
+		item["Guid"] = []map[string]string{{"id": "tvdb://" + ratingKey}}
+	case key >= 2000:
+		item = fs.item("show", ratingKey, 0)
+		item["Guid"] = []map[string]string{{"id": "tvdb://" + ratingKey}}
+	default:
+		item = fs.item("movie", ratingKey, 0)
+		item["Guid"] = []map[string]string{{"id": "tmdb://" + ratingKey}}
+	}
+	fs.write(w, map[string]any{"Metadata": []map[string]any{item}})
+}
+
+// children returns one season for a show and two episodes for a season.
+func (fs *fakeServer) children(w http.ResponseWriter, ratingKey string) {
+	key, _ := strconv.Atoi(ratingKey)
+	switch {
+	case key >= 3000:
+		episodes := []map[string]any{
+			fs.item("episode", strconv.Itoa(key+1000), 1),
+			fs.item("episode", strconv.Itoa(key+1001), 2),
+		}
+		fs.write(w, map[string]any{"Metadata": episodes})
+	case key >= 2000:
+		fs.write(w, map[string]any{"Metadata": []map[string]any{
+			fs.item("season", strconv.Itoa((key-2000)*10+3000), 1),
+		}})
+	default:
+		http.NotFound(w, nil)
+	}
+}
+
+func (fs *fakeServer) write(w http.ResponseWriter, container map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"MediaContainer": container})
+}
+
+func TestPlex_GetLibraryMoviesFake(t *testing.T) {
+	conn := newFakeConnection(t, &fakeServer{movies: 50})
+	lib := &library.Library{Key: "1", Title: "Movies", Type: library.TypeMovie}
+
+	if err := conn.GetLibraryMovies(lib, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(lib.Movies) != 50 {
+		t.Fatalf("expected 50 movies, got %d", len(lib.Movies))
+	}
+	for _, movie := range lib.Movies {
+		if strconv.Itoa(movie.TMDB) != movie.RatingKey {
+			t.Errorf("movie %s got metadata of %d", movie.RatingKey, movie.TMDB)
+		}
+	}
+}
+
+func TestPlex_GetLibraryMoviesItemErrors(t *testing.T) {
+	conn := newFakeConnection(t, &fakeServer{
+		movies: 20,
+		metadataStatus: func(ratingKey string) int {
+			if ratingKey == "1003" || ratingKey == "1011" {
+				return http.StatusInternalServerError
+			}
+			return 0
+		},
+	})
+	lib := &library.Library{Key: "1", Title: "Movies", Type: library.TypeMovie}
+
+	err := conn.GetLibraryMovies(lib, "")
+	if err == nil {
+		t.Fatal("expected an error for the failed movies")
+	}
+	for _, ratingKey := range []string{"1003", "1011"} {
+		if !strings.Contains(err.Error(), "("+ratingKey+")") {
+			t.Errorf("error %q does not mention %s", err, ratingKey)
+		}
+	}
+	for _, movie := range lib.Movies {
+		failed := movie.RatingKey == "1003" || movie.RatingKey == "1011"
+		if !failed && strconv.Itoa(movie.TMDB) != movie.RatingKey {
+			t.Errorf("movie %s got metadata of %d", movie.RatingKey, movie.TMDB)
+		}
+	}
+}
+
+func TestPlex_GetLibraryMoviesFatal(t *testing.T) {
+	fs := &fakeServer{
+		movies: 200,
+		metadataStatus: func(_ string) int {
+			return http.StatusUnauthorized
+		},
+	}
+	conn := newFakeConnection(t, fs)
+	lib := &library.Library{Key: "1", Title: "Movies", Type: library.TypeMovie}
+
+	err := conn.GetLibraryMovies(lib, "")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized error, got %v", err)
+	}
+	if n := fs.metadataRequests.Load(); n >= 200 {
+		t.Fatalf("expected the remaining requests to be canceled, got %d requests", n)
+	}
+}
+
+func TestPlex_PopulateLibrariesFake(t *testing.T) {
+	conn := newFakeConnection(t, &fakeServer{movies: 10, shows: 10})
+
+	if err := conn.InitLibraries(); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.PopulateLibraries()(); err != nil {
+		t.Fatal(err)
+	}
+
+	movies := conn.Libraries.Type(library.TypeMovie)
+	if len(movies) != 1 || len(movies[0].Movies) != 10 {
+		t.Fatalf("expected one library with 10 movies, got %v", movies)
+	}
+	shows := conn.Libraries.Type(library.TypeShow)
+	if len(shows) != 1 || len(shows[0].Shows) != 10 {
+		t.Fatalf("expected one library with 10 shows, got %v", shows)
+	}
+	for _, show := range shows[0].Shows {
+		if strconv.Itoa(show.TVDB) != show.RatingKey {
+			t.Errorf("show %s got metadata of %d", show.RatingKey, show.TVDB)
+		}
+		season := show.Seasons[1]
+		if season == nil || len(season.Episodes) != 2 {
+			t.Fatalf("show %s: expected one season with 2 episodes, got %v", show.RatingKey, show.Seasons)
+		}
+		for _, ep := range season.Episodes {
+			if strconv.Itoa(ep.TVDB) != ep.RatingKey {
+				t.Errorf("episode %s got metadata of %d", ep.RatingKey, ep.TVDB)
+			}
+		}
+	}
+}
+
+func TestPlex_PopulateLibrariesFatal(t *testing.T) {
+	conn := newFakeConnection(t, &fakeServer{
+		movies: 10,
+		shows:  10,
+		metadataStatus: func(_ string) int {
+			return http.StatusForbidden
+		},
+	})
+
+	if err := conn.InitLibraries(); err != nil {
+		t.Fatal(err)
+	}
+	err := conn.PopulateLibraries()()
+	if err == nil {
+		t.Fatal("expected populate to stop")
+	}
+	if !isFatal(err) {
+		t.Fatalf("expected a fatal error, got %v", err)
+	}
+}
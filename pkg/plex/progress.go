@@ -0,0 +1,54 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// libraryIdentifier is the identifier of the library plugin the watch state endpoints need.
+const libraryIdentifier = "com.plexapp.plugins.library"
+
+// SetProgress reports the playback of an item by a player outside of Plex. The timeline makes the playback show up
+// as a session of this client on the dashboard, the progress stores offset as the resume point all clients see.
+// Report playing or paused every few seconds while the item plays and stopped once at the end.
+func (p *Plex) SetProgress(ctx context.Context, ratingKey string, offset time.Duration, state PlaybackState) error {
+	if ratingKey == "" {
+		return errors.New("no ratingKey provided")
+	}
+	switch state {
+	case PlaybackPlaying, PlaybackPaused, PlaybackBuffering, PlaybackStopped:
+	default:
+		return fmt.Errorf("invalid playback state %q", state)
+	}
+	if offset < 0 {
+		return errors.New("progress offset must not be negative")
+	}
+	ms := strconv.FormatInt(offset.Milliseconds(), 10)
+
+	timeline := url.Values{}
+	timeline.Add("ratingKey", ratingKey)
+	timeline.Add("key", path.Join("/library/metadata", ratingKey))
+	timeline.Add("identifier", libraryIdentifier)
+	timeline.Add("state", string(state))
+	timeline.Add("time", ms)
+	timeline.Add("playbackTime", ms)
+	if _, err := get[blank](ctx, p, "/:/timeline", timeline); err != nil {
+		return fmt.Errorf("timeline: %w", err)
+	}
+
+	progress := url.Values{}
+	progress.Add("key", ratingKey)
+	progress.Add("identifier", libraryIdentifier)
+	progress.Add("state", string(state))
+	progress.Add("time", ms)
+	if _, err := get[blank](ctx, p, "/:/progress", progress); err != nil {
+		return fmt.Errorf("progress: %w", err)
+	}
+
+	return nil
+}
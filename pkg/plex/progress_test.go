@@ -0,0 +1,79 @@
+package plex
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingServer answers every request with 200, or 500 for failPath, and records them.
+type recordingServer struct {
+	mu       sync.Mutex
+	methods  []string
+	paths    []string
+	queries  []url.Values
+	failPath string
+}
+
+func (rs *recordingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.methods = append(rs.methods, r.Method)
+	rs.paths = append(rs.paths, r.URL.Path)
+	rs.queries = append(rs.queries, r.URL.Query())
+	if r.URL.Path == rs.failPath {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func TestPlex_SetProgress(t *testing.T) {
+	rs := new(recordingServer)
+	conn := newFakeConnection(t, rs)
+
+	if err := conn.SetProgress(context.Background(), "42", 90*time.Second, PlaybackPaused); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rs.paths) != 2 || rs.paths[0] != "/:/timeline" || rs.paths[1] != "/:/progress" {
+		t.Fatalf("unexpected requests: %v", rs.paths)
+	}
+	timeline := rs.queries[0]
+	if timeline.Get("ratingKey") != "42" || timeline.Get("key") != "/library/metadata/42" ||
+		timeline.Get("state") != "paused" || timeline.Get("time") != "90000" {
+		t.Fatalf("unexpected timeline query: %v", timeline)
+	}
+	progress := rs.queries[1]
+	if progress.Get("key") != "42" || progress.Get("time") != "90000" || progress.Get("state") != "paused" ||
+		progress.Get("identifier") != libraryIdentifier {
+		t.Fatalf("unexpected progress query: %v", progress)
+	}
+}
+
+func TestPlex_SetProgressErrors(t *testing.T) {
+	rs := &recordingServer{failPath: "/:/timeline"}
+	conn := newFakeConnection(t, rs)
+	ctx := context.Background()
+
+	if err := conn.SetProgress(ctx, "", 0, PlaybackPlaying); err == nil {
+		t.Fatal("expected an error without ratingKey")
+	}
+	if err := conn.SetProgress(ctx, "42", 0, "seeking"); err == nil {
+		t.Fatal("expected an error for an invalid state")
+	}
+	if err := conn.SetProgress(ctx, "42", -time.Second, PlaybackPlaying); err == nil {
+		t.Fatal("expected an error for a negative offset")
+	}
+	if len(rs.paths) != 0 {
+		t.Fatalf("invalid arguments sent requests: %v", rs.paths)
+	}
+
+	if err := conn.SetProgress(ctx, "42", 0, PlaybackStopped); err == nil {
+		t.Fatal("expected the timeline error")
+	}
+	if len(rs.paths) != 1 {
+		t.Fatalf("progress sent after a failed timeline: %v", rs.paths)
+	}
+}
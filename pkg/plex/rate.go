@@ -0,0 +1,60 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxRating is the highest user rating, Plex shows it as five stars.
+const maxRating = 10
+
+// Rate sets the user rating of an item from 0 to 10, a negative rating removes it. Once the server applied it the
+// rating is set on the item in Libraries and published to OnChange and Events.
+func (p *Plex) Rate(ctx context.Context, ratingKey string, rating float64) error {
+	if ratingKey == "" {
+		return errors.New("no ratingKey provided")
+	}
+	if rating > maxRating {
+		return fmt.Errorf("rating %v is above %d", rating, maxRating)
+	}
+	if rating < 0 {
+		rating = -1
+	}
+	value := strconv.FormatFloat(rating, 'f', -1, 64)
+
+	query := url.Values{}
+	query.Add("key", ratingKey)
+	query.Add("identifier", libraryIdentifier)
+	query.Add("rating", value)
+	if err := put(ctx, p, "/:/rate", query); err != nil {
+		return err
+	}
+
+	p.applyChange(ChangeEvent{
+		Type:        ChangeRate,
+		RatingKey:   ratingKey,
+		Fields:      map[string]string{"userRating": value},
+		Applied:     time.Now(),
+		LibraryItem: LibraryItem{},
+	}, func(e *ChangeEvent) {
+		setUserRating(e, max(rating, 0))
+	})
+
+	return nil
+}
+
+// setUserRating sets the rating on the rated movie, show or episode, seasons have no user rating in the library.
+func setUserRating(e *ChangeEvent, rating float64) {
+	switch {
+	case e.Movie != nil:
+		e.Movie.UserRating = rating
+	case e.Episode != nil:
+		e.Episode.UserRating = rating
+	case e.Show != nil && e.Season == nil:
+		e.Show.UserRating = rating
+	}
+}
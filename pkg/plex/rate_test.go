@@ -0,0 +1,157 @@
+package plex
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+func TestPlex_Rate(t *testing.T) {
+	rs := new(recordingServer)
+	conn := newFakeConnection(t, rs)
+	movie := &library.Movie{RatingKey: "1", UserRating: 4}
+	episode := &library.Episode{RatingKey: "12"}
+	season := &library.Season{RatingKey: "11", Episodes: library.Episodes{1: episode}}
+	show := &library.Show{RatingKey: "10", Seasons: library.Seasons{1: season}}
+	conn.Libraries = library.Libraries{{Movies: library.Movies{movie}}, {Shows: library.Shows{show}}}
+
+	changes := make(chan ChangeEvent, 10)
+	conn.OnChange(func(e ChangeEvent) { changes <- e })
+	events := conn.Events(context.Background(), func(e Event) bool { return e.Source == SourceChange })
+
+	ctx := context.Background()
+	if err := conn.Rate(ctx, "1", 8.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Rate(ctx, "10", -3); err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.methods[0] != http.MethodPut || rs.paths[0] != "/:/rate" {
+		t.Fatalf("unexpected request: %s %s", rs.methods[0], rs.paths[0])
+	}
+	if q := rs.queries[0]; q.Get("key") != "1" || q.Get("rating") != "8.5" || q.Get("identifier") != libraryIdentifier {
+		t.Fatalf("unexpected query: %v", q)
+	}
+	if q := rs.queries[1]; q.Get("rating") != "-1" {
+		t.Fatalf("cleared rating sent as %q", q.Get("rating"))
+	}
+	if movie.UserRating != 8.5 || show.UserRating != 0 {
+		t.Fatalf("library not updated: movie %v, show %v", movie.UserRating, show.UserRating)
+	}
+
+	for _, want := range []string{"8.5", "-1"} {
+		select {
+		case e := <-changes:
+			if e.Type != ChangeRate || e.Fields["userRating"] != want {
+				t.Fatalf("unexpected change: %+v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("change not published")
+		}
+	}
+	select {
+	case e := <-events:
+		if e.Change == nil || e.Change.Movie != movie || e.Type != string(ChangeRate) {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change not streamed")
+	}
+
+	// rating an episode must leave its show alone
+	show.UserRating = 7
+	if err := conn.Rate(ctx, "12", 2); err != nil {
+		t.Fatal(err)
+	}
+	if show.UserRating != 7 || episode.UserRating != 2 {
+		t.Fatalf("episode rating set show %v and episode %v", show.UserRating, episode.UserRating)
+	}
+}
+
+func TestPlex_RateWaitsForLibraries(t *testing.T) {
+	rs := new(recordingServer)
+	conn := newFakeConnection(t, rs)
+	movie := &library.Movie{RatingKey: "1"}
+	conn.Libraries = library.Libraries{{Movies: library.Movies{movie}}}
+
+	changes := make(chan ChangeEvent, 2)
+	conn.OnChange(func(e ChangeEvent) { changes <- e })
+
+	// another change or a lookup holding the lock delays the update instead of dropping it
+	conn.libraryMu.RLock()
+	done := make(chan error, 1)
+	go func() { done <- conn.Rate(context.Background(), "1", 6) }()
+	time.Sleep(50 * time.Millisecond)
+	conn.libraryMu.RUnlock()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if e := <-changes; e.Movie != movie || movie.UserRating != 6 {
+		t.Fatalf("library not updated: %+v", e)
+	}
+}
+
+func TestPlex_RateDuringPopulate(t *testing.T) {
+	fs := &fakeServer{movies: 3, metadataDelay: 300 * time.Millisecond}
+	conn := newFakeConnection(t, fs)
+	if err := conn.InitLibraries(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.PopulateLibraries()(); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan ChangeEvent, 1)
+	conn.OnChange(func(e ChangeEvent) { changes <- e })
+
+	wait := conn.PopulateLibraries()
+	waitFor(t, "the populate", func() bool {
+		conn.populatingMu.Lock()
+		defer conn.populatingMu.Unlock()
+		return conn.populating
+	})
+
+	// the change must neither wait for the populate nor touch the items it is changing
+	if err := conn.Rate(context.Background(), "1000", 5); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-changes; e.Movie != nil {
+		t.Fatalf("library updated during a populate: %+v", e)
+	}
+	conn.populatingMu.Lock()
+	populating := conn.populating
+	conn.populatingMu.Unlock()
+	if !populating {
+		t.Fatal("the change waited for the populate")
+	}
+
+	if err := wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlex_RateErrors(t *testing.T) {
+	rs := &recordingServer{failPath: "/:/rate"}
+	conn := newFakeConnection(t, rs)
+	movie := &library.Movie{RatingKey: "1", UserRating: 4}
+	conn.Libraries = library.Libraries{{Movies: library.Movies{movie}}}
+
+	ctx := context.Background()
+	if err := conn.Rate(ctx, "", 5); err == nil {
+		t.Fatal("expected an error without ratingKey")
+	}
+	if err := conn.Rate(ctx, "1", 11); err == nil {
+		t.Fatal("expected an error above the maximum")
+	}
+	if err := conn.Rate(ctx, "1", 5); err == nil {
+		t.Fatal("expected the server error")
+	}
+	if movie.UserRating != 4 {
+		t.Fatalf("failed rating changed the library to %v", movie.UserRating)
+	}
+}
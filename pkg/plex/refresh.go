@@ -0,0 +1,90 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// AutoRefreshOptions configure StartAutoRefresh.
+type AutoRefreshOptions struct {
+	// Jitter is the maximum random delay added to each interval so several clients do not hit the server at once.
+	Jitter time.Duration
+	// FullEvery makes every nth run a full populate that also removes the items deleted from the server, the other
+	// runs only fetch the items updated since the previous run. Zero or one makes every run a full populate.
+	FullEvery int
+}
+
+// StartAutoRefresh populates the libraries every interval until ctx is canceled or the client is closed. A run is
+// skipped when the previous one, or one started by PopulateLibraries, is still in progress. The cache is written
+// after every successful run.
+func (p *Plex) StartAutoRefresh(ctx context.Context, interval time.Duration, opts AutoRefreshOptions) error {
+	if interval <= 0 {
+		return errors.New("auto refresh interval must be positive")
+	}
+	if opts.Jitter < 0 {
+		return errors.New("auto refresh jitter must not be negative")
+	}
+
+	ctx, cancel := p.untilClosed(ctx)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer cancel()
+
+		timer := time.NewTimer(nextRefresh(interval, opts.Jitter))
+		defer timer.Stop()
+
+		for run := 1; ; run++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			full := opts.FullEvery <= 1 || run%opts.FullEvery == 0
+			p.autoRefresh(ctx, full)
+
+			timer.Reset(nextRefresh(interval, opts.Jitter))
+		}
+	}()
+
+	return nil
+}
+
+// autoRefresh runs one scheduled populate unless another one is in progress.
+func (p *Plex) autoRefresh(ctx context.Context, full bool) {
+	if !p.populateMu.TryLock() {
+		p.logger.Info("skipping library refresh, a populate is still in progress")
+		return
+	}
+	defer p.populateMu.Unlock()
+
+	// without a previous run there is nothing to be incremental to
+	var since time.Time
+	if !full {
+		since = p.lastPopulate
+	}
+
+	start := time.Now()
+	if err := p.populateLibraries(ctx, since); err != nil {
+		if ctx.Err() == nil {
+			p.logger.Error("library refresh failed", "full", since.IsZero(), "err", err.Error())
+		}
+		return
+	}
+	p.logger.Info("library refreshed", "full", since.IsZero(), "duration", time.Since(start))
+
+	if err := p.writeCache(); err != nil {
+		p.logger.Error("could not write cache", "err", err.Error())
+	}
+}
+
+func nextRefresh(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + rand.N(jitter) //nolint:gosec // jitter does not need a secure random source
+}
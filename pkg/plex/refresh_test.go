@@ -0,0 +1,146 @@
+package plex
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/cache"
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+func TestPlex_StartAutoRefresh(t *testing.T) {
+	fs := &fakeServer{movies: 5, shows: 2}
+	conn := newFakeConnection(t, fs)
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	conn.cache = cache.NewJSONFile(cachePath)
+
+	if err := conn.InitLibraries(); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.PopulateLibraries()(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := conn.StartAutoRefresh(ctx, 10*time.Millisecond, AutoRefreshOptions{FullEvery: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	// PopulateLibraries does not write the cache, the refresh does once it has finished
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(cachePath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no refresh wrote the cache")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	// wait for a run that might have started in the meantime
+	conn.populateMu.Lock()
+	defer conn.populateMu.Unlock()
+
+	fs.mu.Lock()
+	queries := fs.sectionQueries
+	fs.mu.Unlock()
+	if len(queries) == 0 || !strings.Contains(queries[0], "updatedAt") {
+		t.Fatalf("expected an updatedAt filter, got %q", queries)
+	}
+
+	// the incremental refresh must not remove anything
+	if movies := conn.Libraries.Type(library.TypeMovie); len(movies[0].Movies) != 5 {
+		t.Fatalf("expected 5 movies, got %d", len(movies[0].Movies))
+	}
+
+	cached, err := cache.NewJSONFile(cachePath).Load(&library.Library{Title: "Movies"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached == nil || len(cached.Movies) != 5 {
+		t.Fatalf("expected the cache to hold 5 movies, got %+v", cached)
+	}
+}
+
+func TestPlex_StartAutoRefreshInvalid(t *testing.T) {
+	conn := newFakeConnection(t, &fakeServer{})
+	if err := conn.StartAutoRefresh(context.Background(), 0, AutoRefreshOptions{}); err == nil {
+		t.Fatal("expected an error for a zero interval")
+	}
+}
+
+func TestPlex_AutoRefreshSkipsWhileRunning(t *testing.T) {
+	conn := newFakeConnection(t, &fakeServer{})
+
+	conn.populateMu.Lock()
+	before := conn.lastPopulate
+	conn.autoRefresh(context.Background(), true)
+	conn.populateMu.Unlock()
+
+	if conn.lastPopulate != before {
+		t.Fatal("expected the refresh to be skipped")
+	}
+}
+
+func TestPlex_LookupsDoNotSkipRefresh(t *testing.T) {
+	conn := newFakeConnection(t, &fakeServer{movies: 1})
+	if err := conn.InitLibraries(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a lookup holding the libraries delays the refresh instead of skipping it
+	conn.libraryMu.RLock()
+	done := make(chan struct{})
+	go func() {
+		conn.autoRefresh(context.Background(), true)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	conn.libraryMu.RUnlock()
+	<-done
+
+	if conn.lastPopulate.IsZero() {
+		t.Fatal("expected the refresh to run")
+	}
+
+	// holding populateMu outside of a populate, like WriteCache does, must not fail lookups
+	conn.populateMu.Lock()
+	item := conn.findItem("1000")
+	conn.populateMu.Unlock()
+	if item.Movie == nil {
+		t.Fatal("lookup failed while populateMu was held")
+	}
+}
+
+func TestPlex_CloseDuringPopulate(t *testing.T) {
+	fs := &fakeServer{movies: 100, metadataDelay: 50 * time.Millisecond}
+	conn := newFakeConnection(t, fs)
+
+	if err := conn.InitLibraries(); err != nil {
+		t.Fatal(err)
+	}
+	done := conn.PopulateLibraries()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		conn.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on the running populate")
+	}
+	if err := done(); err == nil {
+		t.Fatal("expected the populate to be canceled")
+	}
+}
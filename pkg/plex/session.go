@@ -0,0 +1,307 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/kjbreil/go-plex/internal/plex/api"
+)
+
+// SessionLocation tells whether a player is on the network of the server or connects over the internet.
+type SessionLocation string
+
+const (
+	LocationLAN SessionLocation = "lan"
+	LocationWAN SessionLocation = "wan"
+)
+
+// StreamDecision is how the server delivers a stream to the player.
+type StreamDecision string
+
+const (
+	// DecisionDirectPlay sends the file as it is.
+	DecisionDirectPlay StreamDecision = "directplay"
+	// DecisionCopy remuxes the stream into another container without transcoding it.
+	DecisionCopy StreamDecision = "copy"
+	// DecisionTranscode converts the stream.
+	DecisionTranscode StreamDecision = "transcode"
+	// DecisionBurn renders a subtitle into the video.
+	DecisionBurn StreamDecision = "burn"
+)
+
+// StreamType is the kind of a media stream, the values are the ones Plex uses.
+type StreamType int
+
+const (
+	StreamVideo    StreamType = 1
+	StreamAudio    StreamType = 2
+	StreamSubtitle StreamType = 3
+)
+
+func (t StreamType) String() string {
+	switch t {
+	case StreamVideo:
+		return "video"
+	case StreamAudio:
+		return "audio"
+	case StreamSubtitle:
+		return "subtitle"
+	default:
+		return "unknown"
+	}
+}
+
+// Session is a playback currently running on the server.
+type Session struct {
+	// ID identifies the session for TerminateSession, SessionKey matches the playing notifications.
+	ID         string
+	SessionKey string
+	User       SessionUser
+	Player     SessionPlayer
+	Item       SessionItem
+	State      PlaybackState
+	Offset     time.Duration
+	Duration   time.Duration
+	// Bandwidth is the bandwidth the session uses in kbps.
+	Bandwidth int
+	Location  SessionLocation
+	// Streams are the selected streams of the played media and how each is delivered.
+	Streams []SessionStream
+	// Transcode is the transcoder of the session, nil when every stream is played directly.
+	Transcode *Transcode
+
+	// LibraryItem is the played item.
+	LibraryItem
+}
+
+// SessionUser is the account watching a session.
+type SessionUser struct {
+	ID    string
+	Title string
+	Thumb string
+}
+
+// SessionPlayer is the device playing a session.
+type SessionPlayer struct {
+	Title             string
+	MachineIdentifier string
+	Product           string
+	Platform          string
+	Device            string
+	Address           string
+	PublicAddress     string
+	Local             bool
+}
+
+// SessionItem is the item played in a session, the parent and grandparent fields are only set for episodes and
+// tracks.
+type SessionItem struct {
+	RatingKey            string
+	Key                  string
+	Type                 string
+	Title                string
+	ParentTitle          string
+	GrandparentTitle     string
+	GrandparentRatingKey string
+	Index                int64
+	ParentIndex          int64
+	Year                 int
+	LibrarySectionID     string
+	GUID                 string
+}
+
+// SessionStream is a selected stream of the played media.
+type SessionStream struct {
+	Type         StreamType
+	Codec        string
+	Language     string
+	DisplayTitle string
+	Decision     StreamDecision
+}
+
+// Progress is the part of the item already played, between 0 and 1.
+func (s *Session) Progress() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return min(float64(s.Offset)/float64(s.Duration), 1)
+}
+
+// Transcoding tells whether the server transcodes the video or audio of the session.
+func (s *Session) Transcoding() bool {
+	for _, st := range s.Streams {
+		if st.Decision == DecisionTranscode {
+			return true
+		}
+	}
+	return s.Transcode != nil &&
+		(s.Transcode.VideoDecision == DecisionTranscode || s.Transcode.AudioDecision == DecisionTranscode)
+}
+
+// GetSessions of devices currently consuming media.
+func (p *Plex) GetSessions(ctx context.Context) ([]Session, error) {
+	resp, err := get[api.CurrentSessions](ctx, p, "/status/sessions", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, len(resp.MediaContainer.Metadata))
+	for i, m := range resp.MediaContainer.Metadata {
+		sessions[i] = newSession(m)
+		p.enrichSession(&sessions[i])
+	}
+
+	return sessions, nil
+}
+
+// SessionsByUser returns the current sessions grouped by the title of their user.
+func (p *Plex) SessionsByUser(ctx context.Context) (map[string][]Session, error) {
+	sessions, err := p.GetSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[string][]Session)
+	for _, s := range sessions {
+		byUser[s.User.Title] = append(byUser[s.User.Title], s)
+	}
+
+	return byUser, nil
+}
+
+// ActiveTranscodes returns the current sessions the server transcodes.
+func (p *Plex) ActiveTranscodes(ctx context.Context) ([]Session, error) {
+	sessions, err := p.GetSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var transcodes []Session
+	for _, s := range sessions {
+		if s.Transcoding() {
+			transcodes = append(transcodes, s)
+		}
+	}
+
+	return transcodes, nil
+}
+
+// TerminateSession stops the session with the given Session.ID, the player shows reason to the user. Plex only
+// allows this for servers of a Plex Pass account.
+func (p *Plex) TerminateSession(ctx context.Context, sessionID, reason string) error {
+	if sessionID == "" {
+		return errors.New("no session id provided")
+	}
+
+	query := url.Values{}
+	query.Add("sessionId", sessionID)
+	query.Add("reason", reason)
+
+	_, err := get[blank](ctx, p, "/status/sessions/terminate", query)
+	return err
+}
+
+func (p *Plex) enrichSession(s *Session) {
+	s.LibraryItem = p.findItem(s.Item.RatingKey)
+}
+
+func newSession(m api.Metadata) Session {
+	s := Session{
+		ID:         m.Session.ID,
+		SessionKey: m.SessionKey,
+		User: SessionUser{
+			ID:    m.User.ID,
+			Title: m.User.Title,
+			Thumb: m.User.Thumb,
+		},
+		Player: SessionPlayer{
+			Title:             m.Player.Title,
+			MachineIdentifier: m.Player.MachineIdentifier,
+			Product:           m.Player.Product,
+			Platform:          m.Player.Platform,
+			Device:            m.Player.Device,
+			Address:           m.Player.Address,
+			PublicAddress:     m.Player.RemotePublicAddress,
+			Local:             m.Player.Local,
+		},
+		Item: SessionItem{
+			RatingKey:            m.RatingKey,
+			Key:                  m.Key,
+			Type:                 m.Type,
+			Title:                m.Title,
+			ParentTitle:          m.ParentTitle,
+			GrandparentTitle:     m.GrandparentTitle,
+			GrandparentRatingKey: m.GrandparentRatingKey,
+			Index:                m.Index,
+			ParentIndex:          m.ParentIndex,
+			Year:                 m.Year,
+			LibrarySectionID:     m.LibrarySectionID.String(),
+			GUID:                 m.GUID,
+		},
+		State:       PlaybackState(m.Player.State),
+		Offset:      time.Duration(m.ViewOffset) * time.Millisecond,
+		Duration:    time.Duration(m.Duration) * time.Millisecond,
+		Bandwidth:   m.Session.Bandwidth,
+		Location:    SessionLocation(m.Session.Location),
+		Streams:     nil,
+		Transcode:   nil,
+		LibraryItem: LibraryItem{},
+	}
+	if s.Location == "" {
+		s.Location = LocationWAN
+		if m.Player.Local {
+			s.Location = LocationLAN
+		}
+	}
+	if m.TranscodeSession != nil {
+		s.Transcode = newTranscode(m.TranscodeSession)
+	}
+
+	for _, media := range m.Media {
+		for _, part := range media.Part {
+			for _, st := range part.Stream {
+				t := StreamType(st.StreamType)
+				if t < StreamVideo || t > StreamSubtitle {
+					continue
+				}
+				s.Streams = append(s.Streams, SessionStream{
+					Type:         t,
+					Codec:        st.Codec,
+					Language:     st.Language,
+					DisplayTitle: st.DisplayTitle,
+					Decision:     streamDecision(st.Decision, part.Decision, t, s.Transcode),
+				})
+			}
+		}
+	}
+
+	return s
+}
+
+// streamDecision is the decision of a stream. Older servers leave it out of the stream, it then comes from the
+// transcoder, or from the part when nothing is transcoded.
+func streamDecision(stream, part string, t StreamType, tc *Transcode) StreamDecision {
+	if stream != "" {
+		return StreamDecision(stream)
+	}
+	if tc != nil {
+		var d StreamDecision
+		switch t {
+		case StreamVideo:
+			d = tc.VideoDecision
+		case StreamAudio:
+			d = tc.AudioDecision
+		case StreamSubtitle:
+			d = tc.SubtitleDecision
+		}
+		if d != "" {
+			return d
+		}
+	}
+	if part != "" {
+		return StreamDecision(part)
+	}
+	return DecisionDirectPlay
+}
@@ -0,0 +1,134 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SessionRule decides whether a session breaks a rule, it returns the reason shown to the user or an empty string
+// to keep the session.
+type SessionRule func(s *Session) string
+
+// SessionPolicyOptions configure EnforceSessions.
+type SessionPolicyOptions struct {
+	// Interval checks the sessions at this interval. Zero only checks when a playing notification arrives, which needs
+	// SubscribeToNotifications.
+	Interval time.Duration
+	// DryRun reports the sessions that break a rule without terminating them.
+	DryRun bool
+	// OnTerminate is called for every session that broke a rule with the reason and the error of TerminateSession,
+	// which is always nil with DryRun.
+	OnTerminate func(s Session, reason string, err error)
+}
+
+// EnforceSessions terminates the sessions that break one of the rules until ctx is canceled or the client is closed.
+// The sessions are checked right away, at every interval and whenever a playing notification arrives. The first
+// rule that matches gives the reason, a session is only terminated once.
+func (p *Plex) EnforceSessions(ctx context.Context, opts SessionPolicyOptions, rules ...SessionRule) error {
+	if len(rules) == 0 {
+		return errors.New("no session rules provided")
+	}
+	if opts.Interval < 0 {
+		return errors.New("session policy interval must not be negative")
+	}
+
+	ctx, cancel := p.untilClosed(ctx)
+
+	wake := make(chan struct{}, 1)
+	unsubscribe := p.Websocket.OnPlaying(func(n PlaySessionStateNotification) {
+		if n.State != string(PlaybackPlaying) {
+			return
+		}
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer unsubscribe()
+		defer cancel()
+
+		var tick <-chan time.Time
+		if opts.Interval > 0 {
+			ticker := time.NewTicker(opts.Interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		terminated := make(map[string]struct{})
+		for {
+			p.enforceSessions(ctx, opts, rules, terminated)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+			case <-wake:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// enforceSessions runs one check, terminated holds the sessions already handled and forgets the ones that ended.
+func (p *Plex) enforceSessions(ctx context.Context, opts SessionPolicyOptions, rules []SessionRule,
+	terminated map[string]struct{}) {
+	sessions, err := p.GetSessions(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.logger.Error("could not check sessions", "err", err.Error())
+		}
+		return
+	}
+
+	current := make(map[string]struct{}, len(sessions))
+	for i := range sessions {
+		s := &sessions[i]
+		if s.ID == "" {
+			continue
+		}
+		current[s.ID] = struct{}{}
+		if _, ok := terminated[s.ID]; ok {
+			continue
+		}
+
+		reason := breaksRule(s, rules)
+		if reason == "" {
+			continue
+		}
+
+		if !opts.DryRun {
+			err = p.TerminateSession(ctx, s.ID, reason)
+		}
+		if err != nil {
+			p.logger.Error("could not terminate session", "session", s.ID, "user", s.User.Title, "err", err.Error())
+		} else {
+			p.logger.Info("session breaks a rule", "session", s.ID, "user", s.User.Title, "reason", reason,
+				"terminated", !opts.DryRun)
+			terminated[s.ID] = struct{}{}
+		}
+		if opts.OnTerminate != nil {
+			opts.OnTerminate(*s, reason, err)
+		}
+	}
+
+	for id := range terminated {
+		if _, ok := current[id]; !ok {
+			delete(terminated, id)
+		}
+	}
+}
+
+func breaksRule(s *Session, rules []SessionRule) string {
+	for _, rule := range rules {
+		if reason := rule(s); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,264 @@
+package plex
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const sessionsResponse = `{"MediaContainer":{"size":2,"Metadata":[
+{"sessionKey":"12","ratingKey":"100","type":"movie","title":"Movie","year":2020,"librarySectionID":"1",
+"duration":1000000,"viewOffset":250000,
+"User":{"id":"1","title":"alice","thumb":"https://plex.tv/users/1/avatar"},
+"Player":{"title":"TV","machineIdentifier":"tv-1","product":"Plex for Android","platform":"Android",
+"address":"10.0.0.5","remotePublicAddress":"1.2.3.4","local":true,"state":"playing"},
+"Session":{"id":"abc","bandwidth":4000,"location":"lan"},
+"Media":[{"Part":[{"decision":"transcode","Stream":[
+{"streamType":1,"codec":"hevc","decision":"transcode"},
+{"streamType":2,"codec":"aac","language":"English","decision":"copy"},
+{"streamType":3,"codec":"srt","decision":"burn"}]}]}],
+"TranscodeSession":{"key":"/transcode/sessions/tc1","progress":12.5,"speed":2.5,"throttled":true,
+"videoDecision":"transcode","audioDecision":"copy","subtitleDecision":"burn","sourceVideoCodec":"hevc",
+"videoCodec":"h264","transcodeHwRequested":true,"transcodeHwEncoding":"vaapi"}},
+{"sessionKey":"13","ratingKey":"200","type":"episode","title":"Pilot","grandparentTitle":"Show",
+"parentIndex":1,"index":1,"duration":2000,"viewOffset":0,
+"User":{"id":"2","title":"bob"},
+"Player":{"title":"Phone","machineIdentifier":"phone-1","local":false,"state":"paused"},
+"Session":{"id":"def","bandwidth":8000},
+"Media":[{"Part":[{"decision":"directplay","Stream":[{"streamType":1,"codec":"h264"},{"streamType":2}]}]}]}
+]}}`
+
+func newSessionsConnection(t *testing.T, body string) *Plex {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status/sessions", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	})
+
+	return newFakeConnection(t, mux)
+}
+
+func TestPlex_GetSessions(t *testing.T) {
+	conn := newSessionsConnection(t, sessionsResponse)
+
+	sessions, err := conn.GetSessions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	movie := sessions[0]
+	if movie.ID != "abc" || movie.SessionKey != "12" || movie.User.Title != "alice" || movie.Player.Title != "TV" {
+		t.Fatalf("unexpected session: %+v", movie)
+	}
+	if movie.Item.RatingKey != "100" || movie.Item.LibrarySectionID != "1" || movie.State != PlaybackPlaying {
+		t.Fatalf("unexpected item or state: %+v", movie)
+	}
+	if movie.Offset != 250*time.Second || movie.Progress() != 0.25 {
+		t.Fatalf("unexpected progress: %v %v", movie.Offset, movie.Progress())
+	}
+	if movie.Bandwidth != 4000 || movie.Location != LocationLAN {
+		t.Fatalf("unexpected bandwidth or location: %d %s", movie.Bandwidth, movie.Location)
+	}
+	want := []StreamDecision{DecisionTranscode, DecisionCopy, DecisionBurn}
+	if len(movie.Streams) != len(want) {
+		t.Fatalf("expected %d streams, got %+v", len(want), movie.Streams)
+	}
+	for i, d := range want {
+		if movie.Streams[i].Decision != d {
+			t.Errorf("stream %d: expected %s, got %s", i, d, movie.Streams[i].Decision)
+		}
+	}
+	tc := movie.Transcode
+	if tc == nil || tc.Speed != 2.5 || !tc.Throttled || tc.HardwareEncoding != "vaapi" || tc.VideoCodec != "h264" {
+		t.Fatalf("unexpected transcode: %+v", tc)
+	}
+
+	episode := sessions[1]
+	if episode.Location != LocationWAN || episode.State != PlaybackPaused || episode.Transcode != nil {
+		t.Fatalf("unexpected session: %+v", episode)
+	}
+	if len(episode.Streams) != 2 || episode.Streams[0].Decision != DecisionDirectPlay {
+		t.Fatalf("unexpected streams: %+v", episode.Streams)
+	}
+	if episode.Transcoding() {
+		t.Fatal("direct play reported as transcoding")
+	}
+}
+
+func TestPlex_SessionsByUser(t *testing.T) {
+	conn := newSessionsConnection(t, sessionsResponse)
+
+	byUser, err := conn.SessionsByUser(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byUser) != 2 || len(byUser["alice"]) != 1 || len(byUser["bob"]) != 1 {
+		t.Fatalf("unexpected grouping: %+v", byUser)
+	}
+}
+
+func TestPlex_ActiveTranscodes(t *testing.T) {
+	conn := newSessionsConnection(t, sessionsResponse)
+
+	transcodes, err := conn.ActiveTranscodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcodes) != 1 || transcodes[0].ID != "abc" {
+		t.Fatalf("unexpected transcodes: %+v", transcodes)
+	}
+}
+
+func TestPlex_GetSessionsEmpty(t *testing.T) {
+	conn := newSessionsConnection(t, `{"MediaContainer":{"size":0}}`)
+
+	sessions, err := conn.GetSessions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("expected no sessions, got %+v", sessions)
+	}
+}
+
+// terminateServer serves sessionsResponse and records the terminated sessions.
+type terminateServer struct {
+	mu         sync.Mutex
+	terminated []string
+	reasons    []string
+}
+
+func newTerminateConnection(t *testing.T) (*Plex, *terminateServer) {
+	t.Helper()
+
+	ts := new(terminateServer)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status/sessions", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(sessionsResponse))
+	})
+	mux.HandleFunc("GET /status/sessions/terminate", func(_ http.ResponseWriter, r *http.Request) {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		ts.terminated = append(ts.terminated, r.URL.Query().Get("sessionId"))
+		ts.reasons = append(ts.reasons, r.URL.Query().Get("reason"))
+	})
+
+	return newFakeConnection(t, mux), ts
+}
+
+func (ts *terminateServer) calls() ([]string, []string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return slices.Clone(ts.terminated), slices.Clone(ts.reasons)
+}
+
+func TestPlex_TerminateSession(t *testing.T) {
+	conn, ts := newTerminateConnection(t)
+
+	if err := conn.TerminateSession(context.Background(), "abc", "no transcoding"); err != nil {
+		t.Fatal(err)
+	}
+	ids, reasons := ts.calls()
+	if !slices.Equal(ids, []string{"abc"}) || !slices.Equal(reasons, []string{"no transcoding"}) {
+		t.Fatalf("unexpected termination: %v %v", ids, reasons)
+	}
+
+	if err := conn.TerminateSession(context.Background(), "", "reason"); err == nil {
+		t.Fatal("expected an error without session id")
+	}
+}
+
+func noRemoteAbove(kbps int) SessionRule {
+	return func(s *Session) string {
+		if s.Location == LocationWAN && s.Bandwidth > kbps {
+			return "remote streams are limited"
+		}
+		return ""
+	}
+}
+
+func TestPlex_EnforceSessions(t *testing.T) {
+	conn, ts := newTerminateConnection(t)
+
+	var checks atomic.Int64
+	err := conn.EnforceSessions(context.Background(), SessionPolicyOptions{
+		Interval: 10 * time.Millisecond,
+		DryRun:   false,
+		OnTerminate: func(s Session, _ string, err error) {
+			if err != nil {
+				t.Errorf("terminate %s: %v", s.ID, err)
+			}
+			checks.Add(1)
+		},
+	}, noRemoteAbove(5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "termination", func() bool { return checks.Load() > 0 })
+	// further polls must not terminate the session again
+	time.Sleep(50 * time.Millisecond)
+
+	ids, reasons := ts.calls()
+	if !slices.Equal(ids, []string{"def"}) || reasons[0] != "remote streams are limited" {
+		t.Fatalf("unexpected terminations: %v %v", ids, reasons)
+	}
+	if checks.Load() != 1 {
+		t.Fatalf("expected one report, got %d", checks.Load())
+	}
+}
+
+func TestPlex_EnforceSessionsDryRun(t *testing.T) {
+	conn, ts := newTerminateConnection(t)
+
+	reported := make(chan string, 10)
+	err := conn.EnforceSessions(context.Background(), SessionPolicyOptions{
+		Interval: 0,
+		DryRun:   true,
+		OnTerminate: func(s Session, _ string, _ error) {
+			reported <- s.ID
+		},
+	}, func(s *Session) string {
+		if s.Transcoding() {
+			return "no transcoding"
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-reported:
+		if id != "abc" {
+			t.Fatalf("unexpected session reported: %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session not reported")
+	}
+
+	if ids, _ := ts.calls(); len(ids) != 0 {
+		t.Fatalf("dry run terminated sessions: %v", ids)
+	}
+}
+
+func TestPlex_EnforceSessionsInvalid(t *testing.T) {
+	conn, _ := newTerminateConnection(t)
+
+	opts := SessionPolicyOptions{Interval: 0, DryRun: false, OnTerminate: nil}
+	if err := conn.EnforceSessions(context.Background(), opts); err == nil {
+		t.Fatal("expected an error without rules")
+	}
+	opts.Interval = -time.Second
+	if err := conn.EnforceSessions(context.Background(), opts, noRemoteAbove(0)); err == nil {
+		t.Fatal("expected an error for a negative interval")
+	}
+}
@@ -0,0 +1,152 @@
+package plex
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// defaultQueueSize is how many events a subscriber can fall behind before new events are dropped for it.
+const defaultQueueSize = 100
+
+// subscriber runs a handler on its own goroutine fed by a bounded queue, so a slow handler only delays itself.
+type subscriber[T any] struct {
+	fn     func(T)
+	accept func(T) bool
+	queue  chan T
+}
+
+// subscribers is a set of subscribers that can be changed while events are published to it.
+type subscribers[T any] struct {
+	mu        sync.RWMutex
+	wg        sync.WaitGroup
+	closed    bool
+	queueSize int
+	list      []*subscriber[T]
+}
+
+// subscribe starts a subscriber calling fn for the published events that accept returns true for, a nil accept
+// takes every event. The returned function stops the subscriber after it handled the events already queued.
+func (s *subscribers[T]) subscribe(fn func(T), accept func(T) bool) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return func() {}
+	}
+
+	size := s.queueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	sub := &subscriber[T]{
+		fn:     fn,
+		accept: accept,
+		queue:  make(chan T, size),
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for v := range sub.queue {
+			sub.fn(v)
+		}
+	}()
+
+	s.list = append(s.list, sub)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			i := slices.Index(s.list, sub)
+			if i < 0 {
+				// already stopped by close
+				return
+			}
+			s.list = slices.Delete(s.list, i, i+1)
+			close(sub.queue)
+		})
+	}
+}
+
+// publish queues v for every subscriber that accepts it and reports how many queues were full.
+func (s *subscribers[T]) publish(v T) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var dropped int
+	for _, sub := range s.list {
+		if sub.accept != nil && !sub.accept(v) {
+			continue
+		}
+		select {
+		case sub.queue <- v:
+		default:
+			dropped++
+		}
+	}
+
+	return dropped
+}
+
+// call runs the subscribers that accept v on the calling goroutine instead of queueing v for them, and returns the
+// panics they raised as errors.
+func (s *subscribers[T]) call(v T) error {
+	s.mu.RLock()
+	list := slices.Clone(s.list)
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range list {
+		if sub.accept != nil && !sub.accept(v) {
+			continue
+		}
+		errs = append(errs, callRecover(sub.fn, v))
+	}
+
+	return errors.Join(errs...)
+}
+
+func callRecover[T any](fn func(T), v T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	fn(v)
+
+	return nil
+}
+
+// setQueueSize changes the queue size of the subscribers added afterwards.
+func (s *subscribers[T]) setQueueSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queueSize = size
+}
+
+// close stops every subscriber and waits until they handled their queued events.
+func (s *subscribers[T]) close() {
+	s.mu.Lock()
+	s.closed = true
+	for _, sub := range s.list {
+		close(sub.queue)
+	}
+	s.list = nil
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// logDropped warns about events that were dropped because a subscriber fell behind.
+func logDropped(logger *slog.Logger, dropped int, kind string) {
+	if dropped > 0 {
+		logger.Warn("dropped event for slow handlers, their queue is full", "event", kind, "handlers", dropped)
+	}
+}
@@ -0,0 +1,149 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kjbreil/go-plex/internal/plex/api"
+)
+
+// Transcode is a transcoder session of the server.
+type Transcode struct {
+	// ID identifies the transcode for StopTranscode, it is the last element of Key.
+	ID        string
+	Key       string
+	Progress  float64
+	Speed     float64
+	Throttled bool
+	Complete  bool
+	// Context is streaming for playback and static for downloads and conversions.
+	Context          string
+	Protocol         string
+	Container        string
+	VideoDecision    StreamDecision
+	AudioDecision    StreamDecision
+	SubtitleDecision StreamDecision
+	SourceVideoCodec string
+	VideoCodec       string
+	SourceAudioCodec string
+	AudioCodec       string
+	// HardwareRequested is set when hardware transcoding is enabled, HardwareDecoding and HardwareEncoding name the
+	// hardware used, like vaapi or nvenc, and are empty for software transcoding.
+	HardwareRequested    bool
+	HardwareDecoding     string
+	HardwareEncoding     string
+	HardwareFullPipeline bool
+}
+
+// TranscodeStatus is a running transcode with the playback it serves.
+type TranscodeStatus struct {
+	Transcode Transcode
+	// Session is the playback the transcode serves, nil for downloads, sync and optimize jobs.
+	Session *Session
+}
+
+// GetTranscodes returns the transcoder sessions running on the server.
+func (p *Plex) GetTranscodes(ctx context.Context) ([]Transcode, error) {
+	resp, err := get[api.TranscodeSessions](ctx, p, "/transcode/sessions", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transcodes := make([]Transcode, len(resp.MediaContainer.TranscodeSession))
+	for i := range resp.MediaContainer.TranscodeSession {
+		transcodes[i] = *newTranscode(&resp.MediaContainer.TranscodeSession[i])
+	}
+
+	return transcodes, nil
+}
+
+// GetTranscodeStatus returns the running transcodes together with the playback session each one serves.
+func (p *Plex) GetTranscodeStatus(ctx context.Context) ([]TranscodeStatus, error) {
+	var transcodes []Transcode
+	var sessions []Session
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		var err error
+		transcodes, err = p.GetTranscodes(gctx)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		sessions, err = p.GetSessions(gctx)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return joinTranscodes(transcodes, sessions), nil
+}
+
+// StopTranscode stops the transcode with the given Transcode.ID, a playback it serves ends with it.
+func (p *Plex) StopTranscode(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("no transcode id provided")
+	}
+
+	query := url.Values{}
+	query.Add("session", id)
+
+	_, err := get[blank](ctx, p, "/video/:/transcode/universal/stop", query)
+	return err
+}
+
+// joinTranscodes matches the transcodes to the sessions by their key.
+func joinTranscodes(transcodes []Transcode, sessions []Session) []TranscodeStatus {
+	byKey := make(map[string]*Session, len(sessions))
+	for i := range sessions {
+		if sessions[i].Transcode != nil {
+			byKey[sessions[i].Transcode.Key] = &sessions[i]
+		}
+	}
+
+	status := make([]TranscodeStatus, len(transcodes))
+	for i, t := range transcodes {
+		status[i] = TranscodeStatus{
+			Transcode: t,
+			Session:   byKey[t.Key],
+		}
+	}
+
+	return status
+}
+
+func newTranscode(t *api.Transcode) *Transcode {
+	// path.Base of an empty key is "."
+	var id string
+	if t.Key != "" {
+		id = path.Base(t.Key)
+	}
+
+	return &Transcode{
+		ID:                   id,
+		Key:                  t.Key,
+		Progress:             t.Progress,
+		Speed:                t.Speed,
+		Throttled:            t.Throttled,
+		Complete:             t.Complete,
+		Context:              t.Context,
+		Protocol:             t.Protocol,
+		Container:            t.Container,
+		VideoDecision:        StreamDecision(t.VideoDecision),
+		AudioDecision:        StreamDecision(t.AudioDecision),
+		SubtitleDecision:     StreamDecision(t.SubtitleDecision),
+		SourceVideoCodec:     t.SourceVideoCodec,
+		VideoCodec:           t.VideoCodec,
+		SourceAudioCodec:     t.SourceAudioCodec,
+		AudioCodec:           t.AudioCodec,
+		HardwareRequested:    t.TranscodeHwRequested,
+		HardwareDecoding:     t.TranscodeHwDecoding,
+		HardwareEncoding:     t.TranscodeHwEncoding,
+		HardwareFullPipeline: t.TranscodeHwFullPipeline,
+	}
+}
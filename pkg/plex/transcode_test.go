@@ -0,0 +1,95 @@
+package plex
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/kjbreil/go-plex/internal/plex/api"
+)
+
+const transcodesResponse = `{"MediaContainer":{"size":2,"TranscodeSession":[
+{"key":"/transcode/sessions/tc1","progress":12.5,"speed":2.5,"throttled":true,"context":"streaming",
+"videoDecision":"transcode","audioDecision":"copy","transcodeHwRequested":true,"transcodeHwDecoding":"vaapi",
+"transcodeHwEncoding":"vaapi","transcodeHwFullPipeline":true},
+{"key":"/transcode/sessions/sync-1","progress":80,"speed":4.1,"context":"static","videoDecision":"transcode"}
+]}}`
+
+func newTranscodeConnection(t *testing.T) (*Plex, *[]string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var stopped []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status/sessions", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(sessionsResponse))
+	})
+	mux.HandleFunc("GET /transcode/sessions", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(transcodesResponse))
+	})
+	mux.HandleFunc("GET /video/:/transcode/universal/stop", func(_ http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = append(stopped, r.URL.Query().Get("session"))
+	})
+
+	return newFakeConnection(t, mux), &stopped
+}
+
+func TestPlex_GetTranscodes(t *testing.T) {
+	conn, _ := newTranscodeConnection(t)
+
+	transcodes, err := conn.GetTranscodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcodes) != 2 {
+		t.Fatalf("expected 2 transcodes, got %d", len(transcodes))
+	}
+
+	tc := transcodes[0]
+	if tc.ID != "tc1" || tc.Speed != 2.5 || !tc.Throttled || tc.VideoDecision != DecisionTranscode {
+		t.Fatalf("unexpected transcode: %+v", tc)
+	}
+	if !tc.HardwareRequested || tc.HardwareDecoding != "vaapi" || !tc.HardwareFullPipeline {
+		t.Fatalf("unexpected hardware acceleration: %+v", tc)
+	}
+
+	if tc := newTranscode(&api.Transcode{}); tc.ID != "" {
+		t.Fatalf("expected no id without a key, got %q", tc.ID)
+	}
+}
+
+func TestPlex_GetTranscodeStatus(t *testing.T) {
+	conn, _ := newTranscodeConnection(t)
+
+	status, err := conn.GetTranscodeStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 {
+		t.Fatalf("expected 2 transcodes, got %d", len(status))
+	}
+	if status[0].Session == nil || status[0].Session.ID != "abc" || status[0].Session.User.Title != "alice" {
+		t.Fatalf("transcode not matched to its session: %+v", status[0].Session)
+	}
+	if status[1].Session != nil {
+		t.Fatalf("sync transcode matched to a session: %+v", status[1].Session)
+	}
+}
+
+func TestPlex_StopTranscode(t *testing.T) {
+	conn, stopped := newTranscodeConnection(t)
+
+	if err := conn.StopTranscode(context.Background(), "tc1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*stopped) != 1 || (*stopped)[0] != "tc1" {
+		t.Fatalf("unexpected stops: %v", *stopped)
+	}
+
+	if err := conn.StopTranscode(context.Background(), ""); err == nil {
+		t.Fatal("expected an error without transcode id")
+	}
+}
@@ -1,12 +1,19 @@
 package plex
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	webhook "github.com/kjbreil/go-plex/internal/plex/webhook"
@@ -15,223 +22,425 @@ import (
 // WebhookEvent is an alias for the internal webhook event type.
 type WebhookEvent = webhook.Event
 
-// Webhook holds the actions for each webhook events.
+const (
+	// webhookShutdownTimeout is how long Close waits for webhook requests in flight.
+	webhookShutdownTimeout = 5 * time.Second
+	// defaultThumbnailLimit is the largest thumbnail kept with an event unless SetThumbnailLimit changes it.
+	defaultThumbnailLimit = 1 << 20
+)
+
+// Webhook holds the actions for each webhook events. Like NotificationEvents any number of handlers can be
+// registered, each running on its own goroutine, and every registration returns a function that removes it again.
 type Webhook struct {
-	events map[string]func(w WebhookEvent)
-	port   int
-	ips    []net.IP
+	payloads subscribers[WebhookEvent]
+	port     int
+	ips      []net.IP
+	mux      *http.ServeMux
+	logger   *slog.Logger
+
+	thumbnailLimit atomic.Int64
+	filter         webhookFilter
+	queue          atomic.Pointer[webhookQueue]
+
+	mu         sync.Mutex
+	advertised []string
+	registered []string
+	servers    []*http.Server
 }
 
 func NewWebhook(port int, ips ...net.IP) *Webhook {
-	return &Webhook{
-		port: port,
-		ips:  ips,
-		events: map[string]func(w WebhookEvent){
-			"media.play":     func(_ WebhookEvent) {},
-			"media.pause":    func(_ WebhookEvent) {},
-			"media.resume":   func(_ WebhookEvent) {},
-			"media.stop":     func(_ WebhookEvent) {},
-			"media.scrobble": func(_ WebhookEvent) {},
-			"media.rate":     func(_ WebhookEvent) {},
+	wh := &Webhook{
+		payloads: subscribers[WebhookEvent]{},
+		port:     port,
+		ips:      ips,
+		mux:      http.NewServeMux(),
+		logger:   slog.Default(),
+
+		thumbnailLimit: atomic.Int64{},
+		filter: webhookFilter{
+			mu:             sync.RWMutex{},
+			sources:        nil,
+			secret:         "",
+			servers:        nil,
+			accounts:       nil,
+			maxRequestSize: defaultMaxRequestSize,
+			onReject:       nil,
 		},
+		queue: atomic.Pointer[webhookQueue]{},
+
+		mu:         sync.Mutex{},
+		advertised: nil,
+		registered: nil,
+		servers:    nil,
 	}
+	wh.thumbnailLimit.Store(defaultThumbnailLimit)
+	wh.mux.HandleFunc("POST /", wh.handler)
+
+	return wh
 }
 
-func (p *Plex) ServeWebhook() {
-	for _, ip := range p.Webhook.ips {
-		hookURL := "http://" + net.JoinHostPort(ip.String(), strconv.Itoa(p.Webhook.port)) + "/"
+// Handler returns the handler receiving the webhooks, to mount it into an existing server instead of ServeWebhook.
+// Plex posts to the URL it was registered with, so strip any prefix it is mounted under.
+func (wh *Webhook) Handler() http.Handler {
+	return wh.mux
+}
 
-		hooks, err := p.getWebhooks()
-		if err != nil {
-			panic(err)
+// SetThumbnailLimit sets the size in bytes of the largest thumbnail kept with an event, larger thumbnails are left
+// out. A limit of zero leaves out every thumbnail.
+func (wh *Webhook) SetThumbnailLimit(limit int64) {
+	wh.thumbnailLimit.Store(limit)
+}
+
+// Advertise sets the URLs registered with plex.tv instead of the ones derived from the listen ips, for servers
+// behind NAT, a reverse proxy or an ingress. The URLs are registered as they are, so a secret set by SetSecret has
+// to be part of them.
+func (wh *Webhook) Advertise(urls ...string) error {
+	for _, u := range urls {
+		if err := validateWebhookURL(u); err != nil {
+			return err
 		}
+	}
 
-		var exists bool
-		for _, hook := range hooks {
-			if hook == hookURL {
-				exists = true
-			}
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	wh.advertised = urls
+
+	return nil
+}
+
+// ServeWebhook starts a server listening on each of the ips, or on every interface when only Advertise was used,
+// and registers the webhook URLs with plex.tv. URLs that are registered already are left as they are. The servers
+// are shut down and the URLs this client added removed again by Close. When ServeWebhook fails the servers it
+// started are shut down and the URLs it added removed again, so it can be retried.
+func (p *Plex) ServeWebhook() (err error) {
+	if p.Webhook == nil {
+		return errors.New("no webhook configured")
+	}
+
+	p.Webhook.mu.Lock()
+	defer p.Webhook.mu.Unlock()
+
+	if len(p.Webhook.servers) > 0 {
+		return errors.New("webhook is already served")
+	}
+
+	p.Webhook.logger = p.logger
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, p.unregisterWebhooks(), p.Webhook.shutdownServers())
 		}
-		if !exists {
-			err = p.addWebhook(hookURL)
-			if err != nil {
-				panic(err)
-			}
+	}()
+
+	addrs := make([]string, 0, len(p.Webhook.ips))
+	for _, ip := range p.Webhook.ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), strconv.Itoa(p.Webhook.port)))
+	}
+	if len(addrs) == 0 && len(p.Webhook.advertised) > 0 {
+		addrs = append(addrs, net.JoinHostPort("", strconv.Itoa(p.Webhook.port)))
+	}
+
+	// listen before registering so plex.tv never posts to a closed port
+	for _, addr := range addrs {
+		listener, err := new(net.ListenConfig).Listen(p.ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Errorf("could not listen for webhooks: %w", err)
 		}
 
-		http.HandleFunc("/", p.Webhook.handler)
+		server := &http.Server{
+			Handler:           p.Webhook.mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		p.Webhook.servers = append(p.Webhook.servers, server)
 
+		p.wg.Add(1)
 		go func() {
-			server := &http.Server{
-				Addr:              net.JoinHostPort(ip.String(), strconv.Itoa(p.Webhook.port)),
-				ReadHeaderTimeout: 10 * time.Second,
-			}
-			if serveErr := server.ListenAndServe(); serveErr != nil {
+			defer p.wg.Done()
+			if serveErr := server.Serve(listener); !errors.Is(serveErr, http.ErrServerClosed) {
 				p.logger.Error("webhook server error", "err", serveErr)
 			}
 		}()
 	}
+
+	for _, hookURL := range p.Webhook.hookURLs() {
+		added, err := p.addWebhook(p.ctx, hookURL)
+		if err != nil {
+			return fmt.Errorf("could not add webhook: %w", err)
+		}
+		// a URL that was registered before is not ours to remove
+		if added {
+			p.Webhook.registered = append(p.Webhook.registered, hookURL)
+		}
+	}
+
+	p.playback.attach(p.Webhook)
+
+	return nil
+}
+
+// shutdown gracefully stops the servers started by ServeWebhook.
+func (wh *Webhook) shutdown() error {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	return wh.shutdownServers()
+}
+
+// shutdownServers stops the servers like shutdown, the caller holds mu.
+func (wh *Webhook) shutdownServers() error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, server := range wh.servers {
+		errs = append(errs, server.Shutdown(ctx))
+	}
+	wh.servers = nil
+
+	return errors.Join(errs...)
+}
+
+// hookURLs are the URLs registered with plex.tv, the advertised ones or else one for each listen ip.
+func (wh *Webhook) hookURLs() []string {
+	if len(wh.advertised) > 0 {
+		return wh.advertised
+	}
+
+	urls := make([]string, 0, len(wh.ips))
+	for _, ip := range wh.ips {
+		urls = append(urls, "http://"+net.JoinHostPort(ip.String(), strconv.Itoa(wh.port))+"/"+
+			url.PathEscape(wh.filter.secretPath()))
+	}
+
+	return urls
 }
 
-// Handler listens for plex webhooks and executes the corresponding function.
-func (wh *Webhook) handler(_ http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(0); err != nil {
+// handler listens for plex webhooks and executes the corresponding function.
+func (wh *Webhook) handler(w http.ResponseWriter, r *http.Request) {
+	if reason := wh.filter.checkRequest(r); reason != "" {
+		wh.reject(w, r, reason)
 		return
 	}
+	if limit := wh.filter.limit(); limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
 
-	var hookEvent WebhookEvent
+	// the thumbnail is the only file part, keep it in memory unless it is too large to be used anyway
+	if err := r.ParseMultipartForm(wh.thumbnailLimit.Load()); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			wh.reject(w, r, RejectTooLarge)
+		} else {
+			wh.reject(w, r, RejectMalformed)
+		}
+		return
+	}
+	defer func() {
+		_ = r.MultipartForm.RemoveAll()
+	}()
 
 	payload, hasPayload := r.MultipartForm.Value["payload"]
+	if !hasPayload {
+		wh.reject(w, r, RejectMalformed)
+		return
+	}
 
-	if hasPayload {
-		if err := json.Unmarshal([]byte(payload[0]), &hookEvent); err != nil {
-			return
-		}
+	var hookEvent WebhookEvent
+	if err := json.Unmarshal([]byte(payload[0]), &hookEvent); err != nil {
+		wh.reject(w, r, RejectMalformed)
+		return
+	}
 
-		fn, ok := wh.events[hookEvent.Event]
+	if reason := wh.filter.checkEvent(&hookEvent); reason != "" {
+		wh.reject(w, r, reason)
+		return
+	}
 
-		if !ok {
-			return
+	// queued events are stored without their thumbnail
+	if wq := wh.queue.Load(); wq != nil {
+		if err := wq.enqueue(payload[0]); err != nil {
+			wh.logger.Error("could not queue webhook event", "event", hookEvent.Event, "err", err.Error())
+			http.Error(w, "could not queue webhook event", http.StatusInternalServerError)
 		}
+		return
+	}
 
-		fn(hookEvent)
+	if thumbs := r.MultipartForm.File["thumb"]; len(thumbs) > 0 {
+		thumbnail, err := wh.readThumbnail(thumbs[0])
+		if err != nil {
+			wh.logger.Warn("could not read webhook thumbnail", "event", hookEvent.Event, "err", err.Error())
+		}
+		hookEvent.Thumbnail = thumbnail
 	}
+
+	logDropped(wh.logger, wh.payloads.publish(hookEvent), hookEvent.Event)
 }
 
-// newWebhookEvent attaches a function to each webhook event.
-func (wh *Webhook) newWebhookEvent(eventName string, onEvent func(w WebhookEvent)) error {
-	switch eventName {
-	case "media.play":
-	case "media.pause":
-	case "media.resume":
-	case "media.stop":
-	case "media.scrobble":
-	case "media.rate":
+// reject answers a request that did not pass the safeguards and reports it to OnReject.
+func (wh *Webhook) reject(w http.ResponseWriter, r *http.Request, reason RejectReason) {
+	wh.filter.reject(reason, r)
 
+	switch reason {
+	case RejectTooLarge:
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+	case RejectMalformed:
+		http.Error(w, "invalid webhook request", http.StatusBadRequest)
 	default:
-		return errors.New("invalid event name")
+		http.Error(w, "forbidden", http.StatusForbidden)
 	}
+}
 
-	wh.events[eventName] = onEvent
+// readThumbnail returns the thumbnail part, or nil if it is larger than the limit.
+func (wh *Webhook) readThumbnail(fh *multipart.FileHeader) ([]byte, error) {
+	limit := wh.thumbnailLimit.Load()
+	if fh.Size > limit {
+		return nil, nil
+	}
 
-	return nil
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, limit))
+}
+
+// close stops the queue delivery and the subscribers after they handled the payloads already queued for them.
+func (wh *Webhook) close() {
+	if wq := wh.queue.Swap(nil); wq != nil {
+		if err := wq.stop(); err != nil {
+			wh.logger.Error("could not close webhook queue", "err", err.Error())
+		}
+	}
+	wh.payloads.close()
+}
+
+// Webhook event names as sent by Plex.
+const (
+	WebhookLibraryOnDeck          = "library.on.deck"
+	WebhookLibraryNew             = "library.new"
+	WebhookMediaPause             = "media.pause"
+	WebhookMediaPlay              = "media.play"
+	WebhookMediaRate              = "media.rate"
+	WebhookMediaResume            = "media.resume"
+	WebhookMediaScrobble          = "media.scrobble"
+	WebhookMediaStop              = "media.stop"
+	WebhookAdminDatabaseBackup    = "admin.database.backup"
+	WebhookAdminDatabaseCorrupted = "admin.database.corrupted"
+	WebhookDeviceNew              = "device.new"
+	WebhookPlaybackStarted        = "playback.started"
+)
+
+// on registers fn for the webhook events with the given name.
+func (wh *Webhook) on(event string, fn func(w WebhookEvent)) func() {
+	return wh.payloads.subscribe(fn, func(w WebhookEvent) bool {
+		return w.Event == event
+	})
 }
 
 // OnPlay executes when the webhook receives a play event.
-func (wh *Webhook) OnPlay(fn func(w WebhookEvent)) error {
-	return wh.newWebhookEvent("media.play", fn)
+func (wh *Webhook) OnPlay(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookMediaPlay, fn)
 }
 
 // OnPause executes when the webhook receives a pause event.
-func (wh *Webhook) OnPause(fn func(w WebhookEvent)) error {
-	return wh.newWebhookEvent("media.pause", fn)
+func (wh *Webhook) OnPause(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookMediaPause, fn)
 }
 
 // OnResume executes when the webhook receives a resume event.
-func (wh *Webhook) OnResume(fn func(w WebhookEvent)) error {
-	return wh.newWebhookEvent("media.resume", fn)
+func (wh *Webhook) OnResume(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookMediaResume, fn)
 }
 
 // OnStop executes when the webhook receives a stop event.
-func (wh *Webhook) OnStop(fn func(w WebhookEvent)) error {
-	return wh.newWebhookEvent("media.stop", fn)
+func (wh *Webhook) OnStop(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookMediaStop, fn)
 }
 
-// OnScrobble executes when the webhook receives a scrobble event.
-func (wh *Webhook) OnScrobble(fn func(w WebhookEvent)) error {
-	return wh.newWebhookEvent("media.scrobble", fn)
+// OnScrobble executes when the webhook receives a scrobble event, sent once an item was watched past 90%.
+func (wh *Webhook) OnScrobble(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookMediaScrobble, fn)
 }
 
-// OnRate executes when the webhook receives a rate event.
-func (wh *Webhook) OnRate(fn func(w WebhookEvent)) error {
-	return wh.newWebhookEvent("media.rate", fn)
+// OnRate executes when the webhook receives a rate event, the new rating is in Rating.
+func (wh *Webhook) OnRate(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookMediaRate, fn)
 }
 
-// Webhook setup functions
-
-type webhookHooks struct {
-	URL string `json:"url"`
+// OnLibraryNew executes when an item is added to a library.
+func (wh *Webhook) OnLibraryNew(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookLibraryNew, fn)
 }
 
-func (p *Plex) getWebhooks() ([]string, error) {
-	var webhooks []string
-
-	endpoint := "/api/v2/user/webhooks/"
-
-	resp, err := getHost[[]webhookHooks](p, PlexURL, endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, h := range resp {
-		webhooks = append(webhooks, h.URL)
-	}
+// OnLibraryOnDeck executes when an item is added to the on deck of the account.
+func (wh *Webhook) OnLibraryOnDeck(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookLibraryOnDeck, fn)
+}
 
-	return webhooks, nil
+// OnDatabaseBackup executes when the server finished its scheduled database backup.
+func (wh *Webhook) OnDatabaseBackup(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookAdminDatabaseBackup, fn)
 }
 
-func (p *Plex) addWebhook(webhookURL string) error {
-	// get current webhooks and append ours to it
-	currentWebhooks, err := p.getWebhooks()
+// OnDatabaseCorrupted executes when the server detected a corrupted database.
+func (wh *Webhook) OnDatabaseCorrupted(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookAdminDatabaseCorrupted, fn)
+}
 
-	if err != nil {
-		return err
-	}
+// OnDeviceNew executes when a device connects to the server for the first time.
+func (wh *Webhook) OnDeviceNew(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookDeviceNew, fn)
+}
 
-	currentWebhooks = append(currentWebhooks, webhookURL)
+// OnPlaybackStarted executes when a shared user starts playing, it is sent to the server owner.
+func (wh *Webhook) OnPlaybackStarted(fn func(w WebhookEvent)) func() {
+	return wh.on(WebhookPlaybackStarted, fn)
+}
 
-	return p.setWebhooks(currentWebhooks)
+// OnAny executes for every webhook event.
+func (wh *Webhook) OnAny(fn func(w WebhookEvent)) func() {
+	return wh.payloads.subscribe(fn, nil)
 }
 
-func (p *Plex) removeWebhooks() {
-	if p.Webhook == nil {
-		return
-	}
-	for _, ip := range p.Webhook.ips {
-		hookURL := "http://" + net.JoinHostPort(ip.String(), strconv.Itoa(p.Webhook.port)) + "/"
+// OnUnknown executes for webhook events this package has no typed registration for, like events added to Plex later.
+func (wh *Webhook) OnUnknown(fn func(w WebhookEvent)) func() {
+	return wh.payloads.subscribe(fn, func(w WebhookEvent) bool {
+		return !isKnownWebhookEvent(w.Event)
+	})
+}
 
-		err := p.removeWebhook(hookURL)
-		if err != nil {
-			panic(err)
-		}
+func isKnownWebhookEvent(event string) bool {
+	switch event {
+	case WebhookLibraryOnDeck, WebhookLibraryNew, WebhookMediaPause, WebhookMediaPlay, WebhookMediaRate,
+		WebhookMediaResume, WebhookMediaScrobble, WebhookMediaStop, WebhookAdminDatabaseBackup,
+		WebhookAdminDatabaseCorrupted, WebhookDeviceNew, WebhookPlaybackStarted:
+		return true
+	default:
+		return false
 	}
 }
 
-func (p *Plex) removeWebhook(webhookURL string) error {
-	currentWebhooks, err := p.getWebhooks()
-
-	if err != nil {
-		return err
+// removeWebhooks removes the URLs ServeWebhook added, the other webhooks of the account are kept.
+func (p *Plex) removeWebhooks() error {
+	if p.Webhook == nil {
+		return nil
 	}
 
-	for i, h := range currentWebhooks {
-		if h == webhookURL {
-			currentWebhooks = append(currentWebhooks[:i], currentWebhooks[i+1:]...)
-			break
-		}
-	}
+	p.Webhook.mu.Lock()
+	defer p.Webhook.mu.Unlock()
 
-	return p.setWebhooks(currentWebhooks)
+	return p.unregisterWebhooks()
 }
 
-// SetWebhooks will set your webhooks to whatever you pass as an argument
-// webhooks with a length of 0 will remove all webhooks.
-func (p *Plex) setWebhooks(webhooks []string) error {
-	endpoint := "/api/v2/user/webhooks"
-
-	body := url.Values{}
-
-	if len(webhooks) == 0 {
-		body.Add("urls[]", "")
-	}
-
-	for _, hook := range webhooks {
-		body.Add("urls[]", hook)
+// unregisterWebhooks removes the URLs like removeWebhooks, the caller holds the webhook mu.
+func (p *Plex) unregisterWebhooks() error {
+	var errs []error
+	for _, hookURL := range p.Webhook.registered {
+		// the client context is already canceled when closing
+		errs = append(errs, p.RemoveWebhook(context.Background(), hookURL))
 	}
+	p.Webhook.registered = nil
 
-	err := postHost(p, PlexURL, endpoint, []byte(body.Encode()))
-	if err != nil {
-		return err
-	}
-	return nil
+	return errors.Join(errs...)
 }
@@ -0,0 +1,185 @@
+package plex
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// defaultMaxRequestSize is the largest webhook request accepted unless SetMaxRequestSize changes it. Plex sends the
+// payload with a thumbnail of a few hundred kilobytes at most.
+const defaultMaxRequestSize = 8 << 20
+
+// RejectReason tells why a webhook request was rejected.
+type RejectReason string
+
+const (
+	// RejectSource is a request from an address outside of AllowSources.
+	RejectSource RejectReason = "source"
+	// RejectSecret is a request without the secret set by SetSecret.
+	RejectSecret RejectReason = "secret"
+	// RejectTooLarge is a request larger than SetMaxRequestSize.
+	RejectTooLarge RejectReason = "too_large"
+	// RejectMalformed is a request that is not a multipart form with a valid payload.
+	RejectMalformed RejectReason = "malformed"
+	// RejectServer is an event of a server outside of AllowServers.
+	RejectServer RejectReason = "server"
+	// RejectAccount is an event of an account outside of AllowAccounts.
+	RejectAccount RejectReason = "account"
+)
+
+// webhookFilter holds the safeguards a webhook request has to pass.
+type webhookFilter struct {
+	mu             sync.RWMutex
+	sources        []netip.Prefix
+	secret         string
+	servers        []string
+	accounts       []int
+	maxRequestSize int64
+	onReject       func(reason RejectReason, r *http.Request)
+}
+
+// AllowSources only accepts requests from the given addresses or CIDR ranges, like 10.0.0.0/8 or 192.168.1.5. The
+// address is the peer of the connection, headers like X-Forwarded-For are not trusted.
+func (wh *Webhook) AllowSources(sources ...string) error {
+	prefixes := make([]netip.Prefix, 0, len(sources))
+	for _, source := range sources {
+		prefix, err := parsePrefix(source)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	wh.filter.mu.Lock()
+	defer wh.filter.mu.Unlock()
+	wh.filter.sources = prefixes
+
+	return nil
+}
+
+// SetSecret only accepts requests that carry secret as the last element of their path or as the secret query
+// parameter. ServeWebhook registers its URL with the secret as path.
+func (wh *Webhook) SetSecret(secret string) {
+	wh.filter.mu.Lock()
+	defer wh.filter.mu.Unlock()
+	wh.filter.secret = secret
+}
+
+// AllowServers only handles events of the servers with the given machine identifiers, Server.UUID in the event.
+func (wh *Webhook) AllowServers(uuids ...string) {
+	wh.filter.mu.Lock()
+	defer wh.filter.mu.Unlock()
+	wh.filter.servers = uuids
+}
+
+// AllowAccounts only handles events of the accounts with the given ids, Account.ID in the event.
+func (wh *Webhook) AllowAccounts(ids ...int) {
+	wh.filter.mu.Lock()
+	defer wh.filter.mu.Unlock()
+	wh.filter.accounts = ids
+}
+
+// SetMaxRequestSize sets the size in bytes of the largest request accepted.
+func (wh *Webhook) SetMaxRequestSize(size int64) {
+	wh.filter.mu.Lock()
+	defer wh.filter.mu.Unlock()
+	wh.filter.maxRequestSize = size
+}
+
+// OnReject is called for every rejected request, to count them in metrics. It runs on the request goroutine.
+func (wh *Webhook) OnReject(fn func(reason RejectReason, r *http.Request)) {
+	wh.filter.mu.Lock()
+	defer wh.filter.mu.Unlock()
+	wh.filter.onReject = fn
+}
+
+// checkRequest returns why r must be rejected before its body is read, or an empty reason.
+func (f *webhookFilter) checkRequest(r *http.Request) RejectReason {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.sources) > 0 {
+		addr, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !slices.ContainsFunc(f.sources, func(p netip.Prefix) bool {
+			return p.Contains(addr.Addr().Unmap())
+		}) {
+			return RejectSource
+		}
+	}
+
+	if f.secret != "" && !secretMatches(f.secret, path.Base(r.URL.Path)) &&
+		!secretMatches(f.secret, r.URL.Query().Get("secret")) {
+		return RejectSecret
+	}
+
+	if f.maxRequestSize > 0 && r.ContentLength > f.maxRequestSize {
+		return RejectTooLarge
+	}
+
+	return ""
+}
+
+// checkEvent returns why the event must be dropped, or an empty reason.
+func (f *webhookFilter) checkEvent(e *WebhookEvent) RejectReason {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.servers) > 0 && !slices.Contains(f.servers, e.Server.UUID) {
+		return RejectServer
+	}
+	if len(f.accounts) > 0 && !slices.Contains(f.accounts, e.Account.ID) {
+		return RejectAccount
+	}
+
+	return ""
+}
+
+func (f *webhookFilter) limit() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.maxRequestSize
+}
+
+func (f *webhookFilter) reject(reason RejectReason, r *http.Request) {
+	f.mu.RLock()
+	fn := f.onReject
+	f.mu.RUnlock()
+
+	if fn != nil {
+		fn(reason, r)
+	}
+}
+
+func (f *webhookFilter) secretPath() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.secret
+}
+
+func secretMatches(secret, candidate string) bool {
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(candidate)) == 1
+}
+
+func parsePrefix(source string) (netip.Prefix, error) {
+	if strings.Contains(source, "/") {
+		prefix, err := netip.ParsePrefix(source)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid webhook source %q: %w", source, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(source)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid webhook source %q: %w", source, err)
+	}
+	addr = addr.Unmap()
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,224 @@
+package plex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/queue"
+)
+
+// defaultQueueAttempts is how often a queued webhook event is delivered before it becomes a dead letter.
+const defaultQueueAttempts = 5
+
+// ErrNoQueue is returned by the dead-letter methods of a Webhook that does not use a queue.
+var ErrNoQueue = errors.New("webhook does not use a queue")
+
+// QueueOptions configure the delivery of the events in the webhook queue.
+type QueueOptions struct {
+	// MaxAttempts is how often an event is delivered before it is moved to the dead letters, zero means 5.
+	MaxAttempts int
+	// Backoff is the wait after the first failed attempt, doubled after every further one up to MaxBackoff. Zero
+	// values mean one second and one minute.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// webhookQueue delivers the events stored in a queue.Queue to the handlers.
+type webhookQueue struct {
+	queue  queue.Queue
+	opts   QueueOptions
+	wake   chan struct{}
+	cancel context.CancelFunc
+	// wg tracks the delivery goroutine, stop waits for it before closing the queue.
+	wg sync.WaitGroup
+	// mu keeps requests from pushing to the queue once stop closed it.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// UseQueue stores every webhook event in q before the request is answered and delivers it to the handlers from
+// there, one event at a time and oldest first. A handler fails by panicking, the event is then delivered to all
+// handlers again after a backoff until it becomes a dead letter. Delivery is at least once: a retry also calls the
+// handlers that already handled the event, so they must tolerate duplicates. Events a previous run left in q are
+// delivered right away, so register the handlers first. Thumbnails are not stored, queued events have no Thumbnail.
+// q is closed together with the client.
+func (wh *Webhook) UseQueue(q queue.Queue, opts QueueOptions) error {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultQueueAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wq := &webhookQueue{
+		queue:  q,
+		opts:   opts,
+		wake:   make(chan struct{}, 1),
+		cancel: cancel,
+		wg:     sync.WaitGroup{},
+		mu:     sync.RWMutex{},
+		closed: false,
+	}
+	if !wh.queue.CompareAndSwap(nil, wq) {
+		cancel()
+		return errors.New("webhook already uses a queue")
+	}
+
+	wq.wg.Add(1)
+	go func() {
+		defer wq.wg.Done()
+		wh.deliverQueue(ctx, wq)
+	}()
+
+	return nil
+}
+
+// DeadLetters returns the queued events that could not be delivered.
+func (wh *Webhook) DeadLetters() ([]queue.Message, error) {
+	wq := wh.queue.Load()
+	if wq == nil {
+		return nil, ErrNoQueue
+	}
+	return wq.queue.DeadLetters()
+}
+
+// Replay delivers the dead letters with the given IDs, or all of them without IDs, again and returns how many there
+// were.
+func (wh *Webhook) Replay(ids ...uint64) (int, error) {
+	wq := wh.queue.Load()
+	if wq == nil {
+		return 0, ErrNoQueue
+	}
+
+	n, err := wq.queue.Requeue(ids...)
+	if n > 0 {
+		wq.notify()
+	}
+
+	return n, err
+}
+
+// enqueue stores the payload of a webhook request for delivery.
+func (wq *webhookQueue) enqueue(payload string) error {
+	wq.mu.RLock()
+	defer wq.mu.RUnlock()
+	if wq.closed {
+		return errors.New("webhook queue is closed")
+	}
+
+	_, err := wq.queue.Push(queue.Message{
+		ID:        0,
+		Payload:   json.RawMessage(payload),
+		Received:  time.Now(),
+		Attempts:  0,
+		LastError: "",
+	})
+	if err != nil {
+		return err
+	}
+
+	wq.notify()
+	return nil
+}
+
+func (wq *webhookQueue) notify() {
+	select {
+	case wq.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop waits for the delivery in progress and the requests pushing to the queue, then closes it. Pending events
+// stay in it for the next run.
+func (wq *webhookQueue) stop() error {
+	wq.cancel()
+	wq.wg.Wait()
+
+	wq.mu.Lock()
+	defer wq.mu.Unlock()
+	wq.closed = true
+
+	return wq.queue.Close()
+}
+
+func (wh *Webhook) deliverQueue(ctx context.Context, wq *webhookQueue) {
+	for {
+		pending, err := wq.queue.Pending()
+		if err != nil {
+			wh.logger.Error("could not read the webhook queue", "err", err.Error())
+		}
+		for _, m := range pending {
+			if !wh.deliverQueued(ctx, wq, m) {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wq.wake:
+		}
+	}
+}
+
+// deliverQueued delivers m until it succeeds or becomes a dead letter, it returns false when ctx ended first.
+func (wh *Webhook) deliverQueued(ctx context.Context, wq *webhookQueue, m queue.Message) bool {
+	for {
+		var e WebhookEvent
+		err := json.Unmarshal(m.Payload, &e)
+		decoded := err == nil
+		if decoded {
+			err = wh.payloads.call(e)
+		}
+		if err == nil {
+			if err = wq.queue.Done(m.ID); err != nil {
+				wh.logger.Error("could not remove delivered webhook event", "id", m.ID, "err", err.Error())
+			}
+			return true
+		}
+
+		m.Attempts++
+		m.LastError = err.Error()
+		if !decoded || m.Attempts >= wq.opts.MaxAttempts {
+			wh.logger.Warn("webhook event moved to the dead letters", "id", m.ID, "event", e.Event,
+				"attempts", m.Attempts, "err", m.LastError)
+			if err = wq.queue.Bury(m); err != nil {
+				wh.logger.Error("could not bury webhook event", "id", m.ID, "err", err.Error())
+			}
+			return true
+		}
+
+		wh.logger.Warn("webhook event delivery failed", "id", m.ID, "event", e.Event, "attempts", m.Attempts,
+			"err", m.LastError)
+		if err = wq.queue.Update(m); err != nil {
+			wh.logger.Error("could not update webhook event", "id", m.ID, "err", err.Error())
+		}
+
+		timer := time.NewTimer(queueBackoff(wq.opts, m.Attempts))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// queueBackoff is the wait after the given number of failed attempts.
+func queueBackoff(opts QueueOptions, attempts int) time.Duration {
+	backoff := opts.Backoff
+	for range attempts - 1 {
+		backoff *= 2
+		if backoff >= opts.MaxBackoff {
+			return opts.MaxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,172 @@
+package plex
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/queue"
+)
+
+func newTestQueue(t *testing.T) *queue.Bolt {
+	t.Helper()
+	q, err := queue.NewBolt(filepath.Join(t.TempDir(), "webhooks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWebhook_QueueRetries(t *testing.T) {
+	q := newTestQueue(t)
+	wh := NewWebhook(0)
+	defer wh.close()
+
+	var attempts, delivered atomic.Int32
+	wh.OnScrobble(func(_ WebhookEvent) {
+		if attempts.Add(1) < 3 {
+			panic("database unavailable")
+		}
+		delivered.Add(1)
+	})
+	if err := wh.UseQueue(q, QueueOptions{Backoff: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	wh.handler(rec, webhookRequest(t, "/", `{"event":"media.scrobble"}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	waitFor(t, "the delivery", func() bool {
+		pending, err := q.Pending()
+		return err == nil && len(pending) == 0 && delivered.Load() == 1
+	})
+	if attempts.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestWebhook_QueueDeadLetters(t *testing.T) {
+	q := newTestQueue(t)
+	wh := NewWebhook(0)
+	defer wh.close()
+
+	var failing atomic.Bool
+	failing.Store(true)
+	var delivered atomic.Int32
+	wh.OnAny(func(_ WebhookEvent) {
+		if failing.Load() {
+			panic("always failing")
+		}
+		delivered.Add(1)
+	})
+	if err := wh.UseQueue(q, QueueOptions{MaxAttempts: 2, Backoff: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wh.UseQueue(q, QueueOptions{}); err == nil {
+		t.Fatal("expected an error using a second queue")
+	}
+
+	wh.handler(httptest.NewRecorder(), webhookRequest(t, "/", `{"event":"library.new"}`))
+
+	var dead []queue.Message
+	waitFor(t, "the dead letter", func() bool {
+		var err error
+		dead, err = wh.DeadLetters()
+		return err == nil && len(dead) == 1
+	})
+	if dead[0].Attempts != 2 || dead[0].LastError == "" {
+		t.Fatalf("unexpected dead letter %+v", dead[0])
+	}
+
+	failing.Store(false)
+	n, err := wh.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected to replay one event, got %d", n)
+	}
+	waitFor(t, "the replay", func() bool {
+		return delivered.Load() == 1
+	})
+}
+
+func TestWebhook_QueueDeliversLeftovers(t *testing.T) {
+	q := newTestQueue(t)
+	// left behind by a previous run
+	if _, err := q.Push(queue.Message{Payload: json.RawMessage(`{"event":"media.stop"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	wh := NewWebhook(0)
+	defer wh.close()
+	stopped := make(chan struct{})
+	wh.OnStop(func(_ WebhookEvent) {
+		close(stopped)
+	})
+	if err := wh.UseQueue(q, QueueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the queued event was not delivered")
+	}
+}
+
+func TestWebhook_NoQueue(t *testing.T) {
+	wh := NewWebhook(0)
+	if _, err := wh.DeadLetters(); !errors.Is(err, ErrNoQueue) {
+		t.Fatal("expected ErrNoQueue")
+	}
+	if _, err := wh.Replay(); !errors.Is(err, ErrNoQueue) {
+		t.Fatal("expected ErrNoQueue")
+	}
+}
+
+func TestWebhook_QueueCloseWaitsForDelivery(t *testing.T) {
+	wh := NewWebhook(0)
+	started, release := make(chan struct{}), make(chan struct{})
+	var finished atomic.Bool
+	wh.OnAny(func(_ WebhookEvent) {
+		close(started)
+		<-release
+		finished.Store(true)
+	})
+	if err := wh.UseQueue(newTestQueue(t), QueueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	wq := wh.queue.Load()
+
+	wh.handler(httptest.NewRecorder(), webhookRequest(t, "/", `{"event":"media.play"}`))
+	<-started
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	wh.close()
+
+	if !finished.Load() {
+		t.Fatal("the queue was closed while a delivery was running")
+	}
+	if err := wq.enqueue(`{"event":"media.stop"}`); err == nil {
+		t.Fatal("expected an error pushing to the closed queue")
+	}
+}
@@ -0,0 +1,554 @@
+package plex
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func webhookRequest(t *testing.T, url, payload string) *http.Request {
+	t.Helper()
+	return webhookRequestWithThumb(t, url, payload, nil)
+}
+
+// webhookRequestWithThumb builds a webhook request like Plex sends it, with a thumb part unless thumb is nil.
+func webhookRequestWithThumb(t *testing.T, url, payload string, thumb []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("payload", payload); err != nil {
+		t.Fatal(err)
+	}
+	if thumb != nil {
+		fw, err := mw.CreateFormFile("thumb", "thumb.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fw.Write(thumb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestWebhook_Handler(t *testing.T) {
+	wh := NewWebhook(0)
+	played := make(chan string, 1)
+	wh.OnPlay(func(w WebhookEvent) {
+		played <- w.Metadata.Title
+	})
+
+	// mounted under a prefix of an existing router
+	mux := http.NewServeMux()
+	mux.Handle("/plex/", http.StripPrefix("/plex", wh.Handler()))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.DefaultClient.Do(webhookRequest(t, server.URL+"/plex/",
+		`{"event":"media.play","Metadata":{"title":"Alien"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if title := <-played; title != "Alien" {
+		t.Fatalf("unexpected title %q", title)
+	}
+
+	tests := map[string]struct {
+		request func() *http.Request
+		status  int
+	}{
+		"get": {
+			request: func() *http.Request {
+				r, _ := http.NewRequest(http.MethodGet, server.URL+"/plex/", nil)
+				return r
+			},
+			status: http.StatusMethodNotAllowed,
+		},
+		"not multipart": {
+			request: func() *http.Request {
+				r, _ := http.NewRequest(http.MethodPost, server.URL+"/plex/", strings.NewReader("payload"))
+				return r
+			},
+			status: http.StatusBadRequest,
+		},
+		"invalid payload": {
+			request: func() *http.Request {
+				return webhookRequest(t, server.URL+"/plex/", "{")
+			},
+			status: http.StatusBadRequest,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.DefaultClient.Do(tt.request())
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestWebhook_Events(t *testing.T) {
+	wh := NewWebhook(0)
+
+	var added, corrupted, unknown, all []string
+	wh.OnLibraryNew(func(w WebhookEvent) {
+		added = append(added, w.Metadata.LibrarySectionTitle+"/"+w.Metadata.Title)
+	})
+	wh.OnDatabaseCorrupted(func(w WebhookEvent) {
+		corrupted = append(corrupted, w.Server.Title)
+	})
+	var rating float64
+	wh.OnRate(func(w WebhookEvent) {
+		rating = w.Rating
+	})
+	wh.OnUnknown(func(w WebhookEvent) {
+		unknown = append(unknown, w.Event)
+	})
+	wh.OnAny(func(w WebhookEvent) {
+		all = append(all, w.Event)
+	})
+
+	payloads := []string{
+		`{"event":"library.new","Metadata":{"librarySectionTitle":"Movies","title":"Alien","year":1979}}`,
+		`{"event":"admin.database.corrupted","Server":{"title":"nas"}}`,
+		`{"event":"media.rate","rating":8,"Metadata":{"title":"Alien"}}`,
+		`{"event":"media.unheard.of"}`,
+	}
+	for _, payload := range payloads {
+		postWebhook(t, wh, payload)
+	}
+	wh.close()
+
+	if len(added) != 1 || added[0] != "Movies/Alien" {
+		t.Fatalf("unexpected library.new events %v", added)
+	}
+	if len(corrupted) != 1 || corrupted[0] != "nas" {
+		t.Fatalf("unexpected admin.database.corrupted events %v", corrupted)
+	}
+	if rating != 8 {
+		t.Fatalf("expected rating 8, got %v", rating)
+	}
+	if len(unknown) != 1 || unknown[0] != "media.unheard.of" {
+		t.Fatalf("unexpected unknown events %v", unknown)
+	}
+	if len(all) != len(payloads) {
+		t.Fatalf("expected OnAny for every event, got %v", all)
+	}
+}
+
+func TestPlex_ServeWebhookWithoutWebhook(t *testing.T) {
+	conn, err := New("http://127.0.0.1:32400", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.ServeWebhook(); err == nil {
+		t.Fatal("expected an error without a webhook")
+	}
+}
+
+func TestWebhook_ThumbnailAndMetadata(t *testing.T) {
+	wh := NewWebhook(0)
+	wh.SetThumbnailLimit(8)
+
+	var events []WebhookEvent
+	wh.OnAny(func(w WebhookEvent) {
+		events = append(events, w)
+	})
+
+	payload := `{"event":"media.play","Metadata":{"ratingKey":"42","type":"episode","viewOffset":61000,` +
+		`"Guid":[{"id":"imdb://tt0000001"},{"id":"tmdb://1402"},{"id":"tvdb://5678"}],` +
+		`"Rating":[{"image":"imdb://image.rating","value":8.1,"type":"audience"}],` +
+		`"Director":[{"tag":"Ridley Scott"}],"Role":[{"tag":"Sigourney Weaver"}],` +
+		`"Media":[{"videoResolution":"1080","Part":[{"file":"/movies/alien.mkv"}]}]}}`
+	wh.handler(httptest.NewRecorder(), webhookRequestWithThumb(t, "/", payload, []byte("jpeg")))
+	wh.handler(httptest.NewRecorder(), webhookRequestWithThumb(t, "/", payload, []byte("too large jpeg")))
+	wh.close()
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if string(events[0].Thumbnail) != "jpeg" {
+		t.Fatalf("expected the thumbnail, got %q", events[0].Thumbnail)
+	}
+	if events[1].Thumbnail != nil {
+		t.Fatalf("expected the thumbnail over the limit to be left out, got %q", events[1].Thumbnail)
+	}
+
+	m := events[0].Metadata
+	if m.TMDB() != 1402 || m.TVDB() != 5678 {
+		t.Fatalf("unexpected external ids tmdb %d tvdb %d", m.TMDB(), m.TVDB())
+	}
+	if m.ViewOffset != 61000 || m.Type != "episode" {
+		t.Fatalf("unexpected metadata %+v", m)
+	}
+	if len(m.Director) != 1 || m.Director[0].Tag != "Ridley Scott" || len(m.Role) != 1 {
+		t.Fatalf("unexpected tags director %v role %v", m.Director, m.Role)
+	}
+	if len(m.Rating) != 1 || len(m.Media) != 1 || m.Media[0].Part[0].File != "/movies/alien.mkv" {
+		t.Fatalf("unexpected ratings %v or media %v", m.Rating, m.Media)
+	}
+}
+
+func TestWebhook_Safeguards(t *testing.T) {
+	const payload = `{"event":"media.scrobble","Server":{"uuid":"server-a"},"Account":{"id":1}}`
+
+	tests := map[string]struct {
+		setup   func(wh *Webhook)
+		request func(t *testing.T) *http.Request
+		reason  RejectReason
+		status  int
+	}{
+		"allowed source": {
+			setup: func(wh *Webhook) {
+				if err := wh.AllowSources("10.0.0.0/8", "192.0.2.1"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			request: func(t *testing.T) *http.Request {
+				return webhookRequest(t, "/", payload)
+			},
+			status: http.StatusOK,
+		},
+		"other source": {
+			setup: func(wh *Webhook) {
+				if err := wh.AllowSources("10.0.0.0/8"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			request: func(t *testing.T) *http.Request {
+				return webhookRequest(t, "/", payload)
+			},
+			reason: RejectSource,
+			status: http.StatusForbidden,
+		},
+		"secret in path": {
+			setup: func(wh *Webhook) {
+				wh.SetSecret("s3cret")
+			},
+			request: func(t *testing.T) *http.Request {
+				return webhookRequest(t, "/plex/s3cret", payload)
+			},
+			status: http.StatusOK,
+		},
+		"secret in query": {
+			setup: func(wh *Webhook) {
+				wh.SetSecret("s3cret")
+			},
+			request: func(t *testing.T) *http.Request {
+				return webhookRequest(t, "/?secret=s3cret", payload)
+			},
+			status: http.StatusOK,
+		},
+		"wrong secret": {
+			setup: func(wh *Webhook) {
+				wh.SetSecret("s3cret")
+			},
+			request: func(t *testing.T) *http.Request {
+				return webhookRequest(t, "/guess", payload)
+			},
+			reason: RejectSecret,
+			status: http.StatusForbidden,
+		},
+		"other server": {
+			setup: func(wh *Webhook) {
+				wh.AllowServers("server-b")
+			},
+			request: func(t *testing.T) *http.Request {
+				return webhookRequest(t, "/", payload)
+			},
+			reason: RejectServer,
+			status: http.StatusForbidden,
+		},
+		"other account": {
+			setup: func(wh *Webhook) {
+				wh.AllowServers("server-a")
+				wh.AllowAccounts(2, 3)
+			},
+			request: func(t *testing.T) *http.Request {
+				return webhookRequest(t, "/", payload)
+			},
+			reason: RejectAccount,
+			status: http.StatusForbidden,
+		},
+		"too large": {
+			setup: func(wh *Webhook) {
+				wh.SetMaxRequestSize(64)
+			},
+			request: func(t *testing.T) *http.Request {
+				return webhookRequestWithThumb(t, "/", payload, bytes.Repeat([]byte("x"), 1024))
+			},
+			reason: RejectTooLarge,
+			status: http.StatusRequestEntityTooLarge,
+		},
+		"too large without length": {
+			setup: func(wh *Webhook) {
+				wh.SetMaxRequestSize(64)
+			},
+			request: func(t *testing.T) *http.Request {
+				r := webhookRequestWithThumb(t, "/", payload, bytes.Repeat([]byte("x"), 1024))
+				r.ContentLength = -1
+				return r
+			},
+			reason: RejectTooLarge,
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			wh := NewWebhook(0)
+			tt.setup(wh)
+
+			var rejected []RejectReason
+			wh.OnReject(func(reason RejectReason, _ *http.Request) {
+				rejected = append(rejected, reason)
+			})
+			var handled int
+			wh.OnAny(func(_ WebhookEvent) {
+				handled++
+			})
+
+			r := tt.request(t)
+			r.RemoteAddr = "192.0.2.1:40000"
+			rec := httptest.NewRecorder()
+			wh.handler(rec, r)
+			wh.close()
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.reason == "" {
+				if len(rejected) != 0 || handled != 1 {
+					t.Fatalf("expected the event to be handled, rejected %v", rejected)
+				}
+				return
+			}
+			if len(rejected) != 1 || rejected[0] != tt.reason || handled != 0 {
+				t.Fatalf("expected a %s reject, got %v and %d handled", tt.reason, rejected, handled)
+			}
+		})
+	}
+}
+
+func TestWebhook_AllowSourcesInvalid(t *testing.T) {
+	if err := NewWebhook(0).AllowSources("10.0.0.0/33"); err == nil {
+		t.Fatal("expected an error for an invalid CIDR")
+	}
+	if err := NewWebhook(0).AllowSources("not an ip"); err == nil {
+		t.Fatal("expected an error for an invalid address")
+	}
+}
+
+// fakePlexTV keeps the webhooks of an account like plex.tv does.
+type fakePlexTV struct {
+	mu    sync.Mutex
+	hooks []string
+	posts int
+	// status answers every request with this status when set
+	status int
+	// rejectURL fails the posts that add this URL when set
+	rejectURL string
+}
+
+func (f *fakePlexTV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimSuffix(r.URL.Path, "/") != "/api/v2/user/webhooks" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hooks := make([]webhookHooks, 0, len(f.hooks))
+		for _, h := range f.hooks {
+			hooks = append(hooks, webhookHooks{URL: h})
+		}
+		_ = json.NewEncoder(w).Encode(hooks)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.rejectURL != "" && slices.Contains(r.PostForm["urls[]"], f.rejectURL) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.posts++
+		f.hooks = slices.DeleteFunc(r.PostForm["urls[]"], func(h string) bool {
+			return h == ""
+		})
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakePlexTV) state() ([]string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.hooks), f.posts
+}
+
+func newFakePlexTV(t *testing.T, hooks ...string) (*fakePlexTV, *Plex) {
+	t.Helper()
+	f := &fakePlexTV{hooks: hooks}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	conn, err := New("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.plexTV = server.URL
+	return f, conn
+}
+
+func TestPlex_ServeWebhookAdvertised(t *testing.T) {
+	const advertised = "https://hooks.example.com/plex/s3cret"
+	f, conn := newFakePlexTV(t, "https://other.example.com/", advertised)
+
+	conn.Webhook = NewWebhook(0, net.ParseIP("127.0.0.1"))
+	if err := conn.Webhook.Advertise(advertised); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ServeWebhook(); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ServeWebhook(); err == nil {
+		t.Fatal("expected an error serving twice")
+	}
+
+	// already registered, so nothing was posted
+	hooks, posts := f.state()
+	if posts != 0 || len(hooks) != 2 {
+		t.Fatalf("expected the registration to be left alone, got %v after %d posts", hooks, posts)
+	}
+
+	conn.Close()
+
+	// registered before this client started, so Close keeps it
+	hooks, posts = f.state()
+	if posts != 0 || !slices.Equal(hooks, []string{"https://other.example.com/", advertised}) {
+		t.Fatalf("expected the webhooks to be kept, got %v after %d posts", hooks, posts)
+	}
+}
+
+func TestPlex_ServeWebhookRegisters(t *testing.T) {
+	f, conn := newFakePlexTV(t, "https://other.example.com/")
+
+	conn.Webhook = NewWebhook(0)
+	if err := conn.Webhook.Advertise("http://10.0.0.5:8081/hook"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ServeWebhook(); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, posts := f.state()
+	if posts != 1 || !slices.Equal(hooks, []string{"https://other.example.com/", "http://10.0.0.5:8081/hook"}) {
+		t.Fatalf("expected the webhook to be added once, got %v after %d posts", hooks, posts)
+	}
+
+	conn.Close()
+
+	hooks, _ = f.state()
+	if !slices.Equal(hooks, []string{"https://other.example.com/"}) {
+		t.Fatalf("expected only the other webhook to remain, got %v", hooks)
+	}
+}
+
+func TestPlex_ServeWebhookListenFails(t *testing.T) {
+	f, conn := newFakePlexTV(t)
+	defer conn.Close()
+
+	// the second address is not on this host, so its listen fails after the first server started
+	conn.Webhook = NewWebhook(0, net.ParseIP("127.0.0.1"), net.ParseIP("192.0.2.1"))
+	for range 2 {
+		if err := conn.ServeWebhook(); err == nil {
+			t.Fatal("expected the listen to fail")
+		}
+	}
+
+	conn.Webhook.mu.Lock()
+	servers := len(conn.Webhook.servers)
+	conn.Webhook.mu.Unlock()
+	if servers != 0 {
+		t.Fatalf("expected the started server to be shut down, %d left", servers)
+	}
+	conn.Webhook.payloads.mu.RLock()
+	subscribed := len(conn.Webhook.payloads.list)
+	conn.Webhook.payloads.mu.RUnlock()
+	if subscribed != 0 {
+		t.Fatalf("expected playback not to be attached, got %d subscribers", subscribed)
+	}
+	if hooks, posts := f.state(); posts != 0 || len(hooks) != 0 {
+		t.Fatalf("expected nothing registered, got %v after %d posts", hooks, posts)
+	}
+}
+
+func TestPlex_ServeWebhookRegisterFails(t *testing.T) {
+	f, conn := newFakePlexTV(t, "https://other.example.com/")
+	defer conn.Close()
+	f.rejectURL = "https://b.example.com/hook"
+
+	conn.Webhook = NewWebhook(0, net.ParseIP("127.0.0.1"))
+	if err := conn.Webhook.Advertise("https://a.example.com/hook", f.rejectURL); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ServeWebhook(); err == nil {
+		t.Fatal("expected the registration to fail")
+	}
+
+	// the URL added before the failure is removed again right away, not only by Close
+	hooks, posts := f.state()
+	if posts != 2 || !slices.Equal(hooks, []string{"https://other.example.com/"}) {
+		t.Fatalf("expected the added webhook to be removed, got %v after %d posts", hooks, posts)
+	}
+	conn.Webhook.mu.Lock()
+	registered, servers := len(conn.Webhook.registered), len(conn.Webhook.servers)
+	conn.Webhook.mu.Unlock()
+	if registered != 0 || servers != 0 {
+		t.Fatalf("expected nothing left, got %d registered and %d servers", registered, servers)
+	}
+}
+
+func TestWebhook_AdvertiseInvalid(t *testing.T) {
+	for _, u := range []string{"/relative", "ftp://example.com/", "http://"} {
+		if err := NewWebhook(0).Advertise(u); err == nil {
+			t.Fatalf("expected an error for %q", u)
+		}
+	}
+}
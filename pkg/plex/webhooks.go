@@ -0,0 +1,136 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+var (
+	// ErrUnauthorized is returned when plex.tv rejects the token.
+	ErrUnauthorized = errors.New("plex.tv rejected the token")
+	// ErrPlexPassRequired is returned when the account is not allowed to use webhooks, they need Plex Pass.
+	ErrPlexPassRequired = errors.New("webhooks require a Plex Pass subscription")
+	// ErrInvalidWebhookURL is returned for webhook URLs that are not absolute http or https URLs.
+	ErrInvalidWebhookURL = errors.New("invalid webhook url")
+)
+
+const webhooksEndpoint = "/api/v2/user/webhooks"
+
+type webhookHooks struct {
+	URL string `json:"url"`
+}
+
+// ListWebhooks returns the webhook URLs of the account the token belongs to.
+func (p *Plex) ListWebhooks(ctx context.Context) ([]string, error) {
+	resp, err := getHost[[]webhookHooks](ctx, p, p.plexTV, webhooksEndpoint, nil)
+	if err != nil {
+		return nil, webhooksError(err)
+	}
+
+	webhooks := make([]string, 0, len(resp))
+	for _, h := range resp {
+		webhooks = append(webhooks, h.URL)
+	}
+
+	return webhooks, nil
+}
+
+// AddWebhook adds webhookURL to the webhooks of the account unless it is registered already. Only webhookURL has to
+// be a valid URL, the webhooks already on the account are kept unchanged.
+func (p *Plex) AddWebhook(ctx context.Context, webhookURL string) error {
+	_, err := p.addWebhook(ctx, webhookURL)
+	return err
+}
+
+// addWebhook adds webhookURL like AddWebhook and tells whether it was added, false when it was registered already.
+func (p *Plex) addWebhook(ctx context.Context, webhookURL string) (bool, error) {
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return false, err
+	}
+
+	webhooks, err := p.ListWebhooks(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if slices.Contains(webhooks, webhookURL) {
+		return false, nil
+	}
+
+	if err = p.ReplaceWebhooks(ctx, append(webhooks, webhookURL)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RemoveWebhook removes every entry of webhookURL from the webhooks of the account, the other webhooks are kept.
+func (p *Plex) RemoveWebhook(ctx context.Context, webhookURL string) error {
+	webhooks, err := p.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	remaining := slices.DeleteFunc(slices.Clone(webhooks), func(h string) bool {
+		return h == webhookURL
+	})
+	if len(remaining) == len(webhooks) {
+		return nil
+	}
+
+	return p.ReplaceWebhooks(ctx, remaining)
+}
+
+// ReplaceWebhooks sets the webhooks of the account to webhooks, an empty list removes every webhook. The entries are
+// sent as they are, so the ones listed by ListWebhooks can be passed back even when they are not valid URLs.
+func (p *Plex) ReplaceWebhooks(ctx context.Context, webhooks []string) error {
+	body := url.Values{}
+
+	// plex.tv only clears the list when it gets an empty entry
+	if len(webhooks) == 0 {
+		body.Add("urls[]", "")
+	}
+
+	for _, hook := range webhooks {
+		body.Add("urls[]", hook)
+	}
+
+	if err := postHost(ctx, p, p.plexTV, webhooksEndpoint, []byte(body.Encode())); err != nil {
+		return webhooksError(err)
+	}
+
+	return nil
+}
+
+// webhooksError adds the typed error for the statuses plex.tv answers webhook requests with.
+func webhooksError(err error) error {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return err
+	}
+
+	switch statusErr.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrPlexPassRequired, err)
+	default:
+		return err
+	}
+}
+
+func validateWebhookURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("%w %q: %w", ErrInvalidWebhookURL, webhookURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w %q: must be an absolute http or https url", ErrInvalidWebhookURL, webhookURL)
+	}
+
+	return nil
+}
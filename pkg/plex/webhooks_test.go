@@ -0,0 +1,99 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestPlex_WebhooksAPI(t *testing.T) {
+	f, conn := newFakePlexTV(t, "https://a.example.com/", "https://stale.example.com/")
+	defer conn.Close()
+	ctx := context.Background()
+
+	if err := conn.AddWebhook(ctx, "https://b.example.com/hook"); err != nil {
+		t.Fatal(err)
+	}
+	// adding twice keeps a single entry
+	if err := conn.AddWebhook(ctx, "https://b.example.com/hook"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.RemoveWebhook(ctx, "https://stale.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	// removing what is not there does not post
+	if err := conn.RemoveWebhook(ctx, "https://missing.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, err := conn.ListWebhooks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(hooks, []string{"https://a.example.com/", "https://b.example.com/hook"}) {
+		t.Fatalf("unexpected webhooks %v", hooks)
+	}
+	if _, posts := f.state(); posts != 2 {
+		t.Fatalf("expected 2 posts, got %d", posts)
+	}
+
+	if err = conn.ReplaceWebhooks(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if hooks, _ = f.state(); len(hooks) != 0 {
+		t.Fatalf("expected no webhooks, got %v", hooks)
+	}
+}
+
+func TestPlex_WebhooksAPIInvalidExisting(t *testing.T) {
+	// plex.tv can hold entries that are not URLs, they must not block changing the other webhooks
+	f, conn := newFakePlexTV(t, "not a url", "https://stale.example.com/")
+	defer conn.Close()
+	ctx := context.Background()
+
+	if err := conn.AddWebhook(ctx, "https://b.example.com/hook"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.RemoveWebhook(ctx, "https://stale.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, posts := f.state()
+	if posts != 2 || !slices.Equal(hooks, []string{"not a url", "https://b.example.com/hook"}) {
+		t.Fatalf("unexpected webhooks %v after %d posts", hooks, posts)
+	}
+}
+
+func TestPlex_WebhooksAPIErrors(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		err    error
+	}{
+		"unauthorized": {status: http.StatusUnauthorized, err: ErrUnauthorized},
+		"no plex pass": {status: http.StatusForbidden, err: ErrPlexPassRequired},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, conn := newFakePlexTV(t)
+			defer conn.Close()
+			f.status = tt.status
+
+			_, err := conn.ListWebhooks(context.Background())
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+				t.Fatalf("expected the StatusError to be wrapped, got %v", err)
+			}
+		})
+	}
+
+	_, conn := newFakePlexTV(t)
+	defer conn.Close()
+	if err := conn.AddWebhook(context.Background(), "not a url"); !errors.Is(err, ErrInvalidWebhookURL) {
+		t.Fatalf("expected ErrInvalidWebhookURL, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package queue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltOpenTimeout = time.Second
+
+//nolint:gochecknoglobals // bucket names are constant byte slices
+var (
+	bucketPending = []byte("pending")
+	bucketDead    = []byte("dead")
+)
+
+// Bolt is a queue in an embedded bbolt database. Every change is committed to disk before the method returns.
+type Bolt struct {
+	db *bolt.DB
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBolt opens or creates the bbolt database at path.
+func NewBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketPending, bucketDead} {
+			if _, bucketErr := tx.CreateBucketIfNotExists(name); bucketErr != nil {
+				return bucketErr
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Bolt{
+		db:     db,
+		mu:     sync.RWMutex{},
+		closed: false,
+	}, nil
+}
+
+// Push stores m as the newest pending message.
+func (q *Bolt) Push(m Message) (uint64, error) {
+	err := q.update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(bucketPending)
+
+		id, err := pending.NextSequence()
+		if err != nil {
+			return err
+		}
+		m.ID = id
+
+		return put(pending, m)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return m.ID, nil
+}
+
+// Pending returns the pending messages, oldest first.
+func (q *Bolt) Pending() ([]Message, error) {
+	return q.list(bucketPending)
+}
+
+// Update stores the attempts of a pending message.
+func (q *Bolt) Update(m Message) error {
+	return q.update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(bucketPending)
+		if pending.Get(key(m.ID)) == nil {
+			return ErrNotFound
+		}
+		return put(pending, m)
+	})
+}
+
+// Done removes a delivered message.
+func (q *Bolt) Done(id uint64) error {
+	return q.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPending).Delete(key(id))
+	})
+}
+
+// Bury moves a pending message to the dead-letter bucket.
+func (q *Bolt) Bury(m Message) error {
+	return q.update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketPending).Delete(key(m.ID)); err != nil {
+			return err
+		}
+		return put(tx.Bucket(bucketDead), m)
+	})
+}
+
+// DeadLetters returns the messages in the dead-letter bucket, oldest first.
+func (q *Bolt) DeadLetters() ([]Message, error) {
+	return q.list(bucketDead)
+}
+
+// Requeue moves dead letters back to the pending messages.
+func (q *Bolt) Requeue(ids ...uint64) (int, error) {
+	var moved int
+	err := q.update(func(tx *bolt.Tx) error {
+		dead := tx.Bucket(bucketDead)
+		pending := tx.Bucket(bucketPending)
+
+		var requeue []Message
+		err := dead.ForEach(func(_, v []byte) error {
+			var m Message
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			if len(ids) == 0 || slices.Contains(ids, m.ID) {
+				requeue = append(requeue, m)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// deleting while iterating skips keys, so move them afterwards
+		for _, m := range requeue {
+			if err = dead.Delete(key(m.ID)); err != nil {
+				return err
+			}
+			m.Attempts = 0
+			m.LastError = ""
+			if err = put(pending, m); err != nil {
+				return err
+			}
+		}
+		moved = len(requeue)
+
+		return nil
+	})
+
+	return moved, err
+}
+
+// Close closes the database.
+func (q *Bolt) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+
+	return q.db.Close()
+}
+
+func (q *Bolt) update(fn func(tx *bolt.Tx) error) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	return q.db.Update(fn)
+}
+
+func (q *Bolt) list(bucket []byte) ([]Message, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return nil, ErrClosed
+	}
+
+	var messages []Message
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			var m Message
+			if err := json.Unmarshal(v, &m); err != nil {
+				return fmt.Errorf("could not decode queued message %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			messages = append(messages, m)
+			return nil
+		})
+	})
+
+	return messages, err
+}
+
+func put(b *bolt.Bucket, m Message) error {
+	v, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return b.Put(key(m.ID), v)
+}
+
+// key encodes id big endian so the keys sort in the order of the IDs.
+func key(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestBolt(t *testing.T, path string) *Bolt {
+	t.Helper()
+	q, err := NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func push(t *testing.T, q Queue, payload string) uint64 {
+	t.Helper()
+	id, err := q.Push(Message{Payload: json.RawMessage(payload), Received: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func ids(messages []Message) []uint64 {
+	rtn := make([]uint64, 0, len(messages))
+	for _, m := range messages {
+		rtn = append(rtn, m.ID)
+	}
+	return rtn
+}
+
+func TestBolt_Lifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	q := newTestBolt(t, path)
+
+	first := push(t, q, `{"event":"media.play"}`)
+	second := push(t, q, `{"event":"media.pause"}`)
+	third := push(t, q, `{"event":"media.stop"}`)
+	if first >= second || second >= third {
+		t.Fatalf("expected growing ids, got %d %d %d", first, second, third)
+	}
+
+	pending, err := q.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 3 || string(pending[1].Payload) != `{"event":"media.pause"}` {
+		t.Fatalf("unexpected pending messages %+v", pending)
+	}
+
+	if err = q.Done(first); err != nil {
+		t.Fatal(err)
+	}
+	pending[1].Attempts = 3
+	pending[1].LastError = "boom"
+	if err = q.Update(pending[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Bury(pending[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Update(Message{ID: first}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound updating a delivered message, got %v", err)
+	}
+
+	// everything survives a restart
+	if err = q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	q = newTestBolt(t, path)
+	defer q.Close()
+
+	pending, err = q.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(pending); len(got) != 1 || got[0] != third {
+		t.Fatalf("expected only the third message pending, got %v", got)
+	}
+	dead, err := q.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != second || dead[0].Attempts != 3 || dead[0].LastError != "boom" {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+
+	n, err := q.Requeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected one requeued message, got %d", n)
+	}
+	pending, err = q.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(pending); len(got) != 2 || got[0] != second || pending[0].Attempts != 0 {
+		t.Fatalf("expected the requeued message first with its attempts reset, got %+v", pending)
+	}
+}
+
+func TestBolt_RequeueIDs(t *testing.T) {
+	q := newTestBolt(t, filepath.Join(t.TempDir(), "queue.db"))
+	defer q.Close()
+
+	for range 3 {
+		id := push(t, q, `{}`)
+		if err := q.Bury(Message{ID: id, Payload: json.RawMessage(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := q.Requeue(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected one requeued message, got %d", n)
+	}
+	dead, err := q.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(dead); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Fatalf("unexpected dead letters %v", got)
+	}
+}
+
+func TestBolt_Closed(t *testing.T) {
+	q := newTestBolt(t, filepath.Join(t.TempDir(), "queue.db"))
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Push(Message{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if _, err := q.Pending(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Package queue persists messages between their receipt and their delivery, so a crash or a failing consumer does
+// not lose them.
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrClosed is returned when a queue is used after Close.
+	ErrClosed = errors.New("queue is closed")
+	// ErrNotFound is returned for a message that is not in the queue.
+	ErrNotFound = errors.New("message not found")
+)
+
+// Message is a queued message and its delivery attempts so far.
+type Message struct {
+	ID        uint64          `json:"id"`
+	Payload   json.RawMessage `json:"payload"`
+	Received  time.Time       `json:"received"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError,omitempty"`
+}
+
+// Queue is a durable FIFO of pending messages with a dead-letter store for the messages that could not be delivered.
+type Queue interface {
+	// Push stores a pending message and returns its ID, IDs grow with every push.
+	Push(m Message) (uint64, error)
+	// Pending returns the pending messages, oldest first.
+	Pending() ([]Message, error)
+	// Update stores the attempts of a pending message.
+	Update(m Message) error
+	// Done removes a delivered message.
+	Done(id uint64) error
+	// Bury moves a pending message to the dead-letter store.
+	Bury(m Message) error
+	// DeadLetters returns the messages in the dead-letter store, oldest first.
+	DeadLetters() ([]Message, error)
+	// Requeue moves the dead letters with the given IDs, or all of them without IDs, back to the pending messages
+	// with their attempts reset, and returns how many were moved.
+	Requeue(ids ...uint64) (int, error)
+	Close() error
+}
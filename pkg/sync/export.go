@@ -0,0 +1,291 @@
+package sync
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+	"github.com/kjbreil/go-plex/pkg/plex"
+)
+
+// Record is the watch state of a movie or an episode. It is keyed by the external ids of the item instead of its
+// ratingKey, so it can be imported into another server or after the item was added again.
+type Record struct {
+	// Type is movie or episode.
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	// GUID is only set for the guids of global agents, local guids differ between servers and after re-adding.
+	GUID         string     `json:"guid,omitempty"`
+	IMDB         string     `json:"imdb,omitempty"`
+	TMDB         int        `json:"tmdb,omitempty"`
+	TVDB         int        `json:"tvdb,omitempty"`
+	Watched      bool       `json:"watched"`
+	LastViewedAt *time.Time `json:"lastViewedAt,omitempty"`
+	// ViewOffset is the resume point in milliseconds.
+	ViewOffset int     `json:"viewOffset,omitempty"`
+	Rating     float64 `json:"rating,omitempty"`
+}
+
+// csvHeader are the columns of WriteCSV, ReadCSV finds them by name.
+//
+//nolint:gochecknoglobals // fixed column layout
+var csvHeader = []string{
+	"type", "title", "guid", "imdb", "tmdb", "tvdb", "watched", "last_viewed_at", "view_offset", "rating",
+}
+
+// ImportOptions configure Import.
+type ImportOptions struct {
+	// DryRun only reports the actions without applying them.
+	DryRun bool
+}
+
+// Export returns the records of the movies and episodes in libs that were watched, started or rated.
+func Export(libs library.Libraries) []Record {
+	var records []Record
+	for _, it := range items(libs) {
+		if (!it.watched && it.offset <= 0 && it.rating <= 0) || len(it.keys()) == 0 {
+			continue
+		}
+		records = append(records, it.record())
+	}
+	return records
+}
+
+// Import applies the records to the matching items in the Libraries of client with Scrobble, SetProgress and Rate.
+// Items are matched by their external ids like in Sync, so local guids are ignored and ambiguous matches are left
+// alone. Import only adds state, it never marks an item unwatched or removes a rating, and it skips the resume point
+// of items watched on client. The actions are reported on SideA.
+func Import(ctx context.Context, client *plex.Plex, records []Record, opts ImportOptions) (*Report, error) {
+	recs := make([]*item, 0, len(records))
+	for i := range records {
+		recs = append(recs, records[i].item())
+	}
+
+	report := &Report{
+		Matched:   0,
+		Unmatched: 0,
+		Ambiguous: 0,
+		Actions:   nil,
+	}
+	for _, m := range matchAll(recs, index(items(client.Libraries)), report) {
+		for _, action := range restore(m.from, m.to) {
+			action.MatchedBy = m.by
+			report.Actions = append(report.Actions, action)
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	return report, applyAll(ctx, report, func(Side) *plex.Plex { return client })
+}
+
+// restore returns the actions that add the state of rec to local.
+func restore(rec, local *item) []Action {
+	var actions []Action
+	if rec.watched && !local.watched {
+		actions = append(actions, newAction(SideA, ActionWatched, local))
+	}
+	if !rec.watched && !local.watched && rec.offset > 0 && rec.offset != local.offset {
+		action := newAction(SideA, ActionOffset, local)
+		action.Offset = rec.offset
+		actions = append(actions, action)
+	}
+	if rec.rating > 0 && rec.rating != local.rating {
+		action := newAction(SideA, ActionRating, local)
+		action.Rating = rec.rating
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+func (it *item) record() Record {
+	var lastViewedAt *time.Time
+	if !it.lastViewedAt.IsZero() {
+		t := it.lastViewedAt
+		lastViewedAt = &t
+	}
+
+	var guid string
+	if globalGUID(it.guid) {
+		guid = it.guid
+	}
+
+	return Record{
+		Type:         it.kind,
+		Title:        it.title,
+		GUID:         guid,
+		IMDB:         it.imdb,
+		TMDB:         it.tmdb,
+		TVDB:         it.tvdb,
+		Watched:      it.watched,
+		LastViewedAt: lastViewedAt,
+		ViewOffset:   int(it.offset.Milliseconds()),
+		Rating:       it.rating,
+	}
+}
+
+func (r *Record) item() *item {
+	return &item{
+		kind:         r.Type,
+		ratingKey:    "",
+		title:        r.Title,
+		guid:         r.GUID,
+		imdb:         r.IMDB,
+		tmdb:         r.TMDB,
+		tvdb:         r.TVDB,
+		watched:      r.Watched,
+		lastViewedAt: timeOrZero(r.LastViewedAt),
+		offset:       time.Duration(r.ViewOffset) * time.Millisecond,
+		rating:       r.Rating,
+	}
+}
+
+// WriteJSON writes the records as an indented JSON array.
+func WriteJSON(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// ReadJSON reads records written by WriteJSON.
+func ReadJSON(r io.Reader) ([]Record, error) {
+	var records []Record
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// WriteCSV writes the records as CSV with a header row, times are RFC 3339.
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		var lastViewedAt string
+		if r.LastViewedAt != nil {
+			lastViewedAt = r.LastViewedAt.Format(time.RFC3339)
+		}
+		row := []string{
+			r.Type,
+			r.Title,
+			r.GUID,
+			r.IMDB,
+			formatID(r.TMDB),
+			formatID(r.TVDB),
+			strconv.FormatBool(r.Watched),
+			lastViewedAt,
+			strconv.Itoa(r.ViewOffset),
+			strconv.FormatFloat(r.Rating, 'f', -1, 64),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads records written by WriteCSV. Columns are found by the header, missing columns stay empty.
+func ReadCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	if _, ok := columns["type"]; !ok {
+		return nil, errors.New("csv has no type column")
+	}
+
+	var records []Record
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rec, err := parseRow(row, columns)
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func parseRow(row []string, columns map[string]int) (Record, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var rec Record
+	var err error
+	rec.Type = field("type")
+	rec.Title = field("title")
+	rec.GUID = field("guid")
+	rec.IMDB = field("imdb")
+	if rec.TMDB, err = parseID(field("tmdb")); err != nil {
+		return rec, fmt.Errorf("tmdb: %w", err)
+	}
+	if rec.TVDB, err = parseID(field("tvdb")); err != nil {
+		return rec, fmt.Errorf("tvdb: %w", err)
+	}
+	if v := field("watched"); v != "" {
+		if rec.Watched, err = strconv.ParseBool(v); err != nil {
+			return rec, fmt.Errorf("watched: %w", err)
+		}
+	}
+	if v := field("last_viewed_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return rec, fmt.Errorf("last_viewed_at: %w", err)
+		}
+		rec.LastViewedAt = &t
+	}
+	if rec.ViewOffset, err = parseID(field("view_offset")); err != nil {
+		return rec, fmt.Errorf("view_offset: %w", err)
+	}
+	if v := field("rating"); v != "" {
+		if rec.Rating, err = strconv.ParseFloat(v, 64); err != nil {
+			return rec, fmt.Errorf("rating: %w", err)
+		}
+	}
+
+	return rec, nil
+}
+
+func formatID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+func parseID(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+)
+
+func TestExport(t *testing.T) {
+	libs := library.Libraries{
+		{Movies: library.Movies{
+			{Title: "Watched", GUID: "plex://movie/1", IMDB: "tt1", TMDB: 1, Watched: true, LastViewedAt: at(5)},
+			{Title: "Started", GUID: "plex://movie/2", ViewOffset: 60000},
+			{Title: "Rated", GUID: "local://3", TMDB: 3, UserRating: 7.5},
+			{Title: "Untouched", GUID: "plex://movie/4"},
+			{Title: "No ids", GUID: "local://5", Watched: true},
+		}},
+		{Shows: library.Shows{{Title: "Show", Seasons: library.Seasons{1: {Episodes: library.Episodes{
+			1: {Title: "Pilot", TVDB: 1000, Watched: true},
+		}}}}}},
+	}
+
+	records := Export(libs)
+	var titles []string
+	for _, r := range records {
+		titles = append(titles, r.Title)
+	}
+	if want := []string{"Watched", "Started", "Rated", "Show - Pilot"}; !slices.Equal(titles, want) {
+		t.Fatalf("unexpected records:\n got %v\nwant %v", titles, want)
+	}
+	if records[0].IMDB != "tt1" || !records[0].LastViewedAt.Equal(*at(5)) || records[1].ViewOffset != 60000 {
+		t.Fatalf("unexpected records: %+v", records[:2])
+	}
+	if records[2].GUID != "" {
+		t.Fatalf("local guid exported: %+v", records[2])
+	}
+
+	var js bytes.Buffer
+	if err := WriteJSON(&js, records); err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ReadJSON(&js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON, records) {
+		t.Fatalf("json round trip changed the records:\n got %+v\nwant %+v", fromJSON, records)
+	}
+
+	var csv bytes.Buffer
+	if err = WriteCSV(&csv, records); err != nil {
+		t.Fatal(err)
+	}
+	fromCSV, err := ReadCSV(&csv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromCSV, records) {
+		t.Fatalf("csv round trip changed the records:\n got %+v\nwant %+v", fromCSV, records)
+	}
+}
+
+func TestReadCSVInvalid(t *testing.T) {
+	for name, input := range map[string]string{
+		"no type column": "title,watched\nMovie,true\n",
+		"invalid bool":   "type,title,watched\nmovie,Movie,maybe\n",
+		"invalid time":   "type,last_viewed_at\nmovie,yesterday\n",
+	} {
+		if _, err := ReadCSV(bytes.NewBufferString(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	records := []Record{
+		// re-added with a new guid and ratingKey, matched by imdb
+		{Type: "movie", Title: "Watched", GUID: "plex://movie/old", IMDB: "tt1", Watched: true},
+		{Type: "movie", Title: "Started", TMDB: 2, ViewOffset: 60000},
+		// the rating is added, the unwatched state is not
+		{Type: "movie", Title: "Rated", TMDB: 3, Rating: 8},
+		{Type: "episode", Title: "Show - Pilot", TVDB: 1000, Watched: true},
+		{Type: "movie", Title: "Gone", TMDB: 99, Watched: true},
+		// a local guid from another server names a different item
+		{Type: "movie", Title: "Home Video", GUID: "local://14", Watched: true},
+	}
+	libs := library.Libraries{
+		{Movies: library.Movies{
+			{RatingKey: "11", Title: "Watched", GUID: "plex://movie/new", IMDB: "tt1"},
+			{RatingKey: "12", Title: "Started", TMDB: 2},
+			{RatingKey: "13", Title: "Rated", TMDB: 3, Watched: true},
+			{RatingKey: "14", Title: "Other Video", GUID: "local://14"},
+		}},
+		{Shows: library.Shows{{Title: "Show", Seasons: library.Seasons{1: {Episodes: library.Episodes{
+			1: {RatingKey: "20", Title: "Pilot", TVDB: 1000, Watched: true},
+		}}}}}},
+	}
+	client, srv := newClient(t, libs)
+
+	report, err := Import(context.Background(), client, records, ImportOptions{DryRun: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 4 || report.Unmatched != 2 {
+		t.Fatalf("unexpected matches: %d matched, %d unmatched", report.Matched, report.Unmatched)
+	}
+	want := []string{"/:/scrobble 11", "/:/progress 12 60000", "/:/rate 13 8"}
+	if got := srv.got(); !slices.Equal(got, want) {
+		t.Fatalf("unexpected requests:\n got %v\nwant %v", got, want)
+	}
+	if report.Actions[0].MatchedBy != "imdb" {
+		t.Fatalf("matched by %q", report.Actions[0].MatchedBy)
+	}
+}
@@ -0,0 +1,386 @@
+// Package sync reconciles the watched state, resume points and ratings of the movies and episodes two Plex servers
+// have in common, and exports and imports them to move them between servers or keep a backup.
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+	"github.com/kjbreil/go-plex/pkg/plex"
+)
+
+// Policy decides which server wins when the two disagree about an item.
+type Policy int
+
+const (
+	// LatestViewed takes the state of the server that viewed the item last. When neither viewed it, or both at the
+	// same time, the watched side wins.
+	LatestViewed Policy = iota
+	// PreferA always takes the state of server A.
+	PreferA
+	// PreferB always takes the state of server B.
+	PreferB
+)
+
+// Side is one of the two servers.
+type Side int
+
+const (
+	SideA Side = iota
+	SideB
+)
+
+func (s Side) String() string {
+	if s == SideB {
+		return "b"
+	}
+	return "a"
+}
+
+// ActionKind is the change an Action makes.
+type ActionKind string
+
+const (
+	ActionWatched   ActionKind = "watched"
+	ActionUnwatched ActionKind = "unwatched"
+	ActionOffset    ActionKind = "offset"
+	ActionRating    ActionKind = "rating"
+)
+
+// Options configure Sync.
+type Options struct {
+	Policy Policy
+	// DryRun only reports the actions without applying them.
+	DryRun bool
+}
+
+// Action is one change of an item on one server.
+type Action struct {
+	// Side is the server that is changed.
+	Side      Side
+	Kind      ActionKind
+	RatingKey string
+	Title     string
+	// MatchedBy is how the item was matched to the other server, guid, imdb, tmdb or tvdb.
+	MatchedBy string
+	// Offset is the new resume point of ActionOffset, Rating the new rating of ActionRating.
+	Offset time.Duration
+	Rating float64
+	// Err is the error applying the action, always nil in a dry run.
+	Err error
+}
+
+// Report tells what Sync did, or would do in a dry run.
+type Report struct {
+	// Matched is the number of items found on both servers, Unmatched the number of items of A missing on B.
+	Matched   int
+	Unmatched int
+	// Ambiguous is the number of items of A left alone because their ids match several items of B, or because
+	// another item of A matches the same item of B, like a movie that is in two libraries.
+	Ambiguous int
+	Actions   []Action
+}
+
+// Sync matches the movies and episodes in the Libraries of a and b and copies the watched state, resume point and
+// rating of the winning side, by opts.Policy, to the other. An item rated on one side only gets that rating on the
+// other, whatever the policy. Both clients need populated Libraries. Failed actions are reported and joined into
+// the returned error, the other actions are applied nonetheless.
+func Sync(ctx context.Context, a, b *plex.Plex, opts Options) (*Report, error) {
+	report := &Report{
+		Matched:   0,
+		Unmatched: 0,
+		Ambiguous: 0,
+		Actions:   nil,
+	}
+	for _, m := range matchAll(items(a.Libraries), index(items(b.Libraries)), report) {
+		for _, action := range reconcile(m.from, m.to, opts.Policy) {
+			action.MatchedBy = m.by
+			report.Actions = append(report.Actions, action)
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	return report, applyAll(ctx, report, func(side Side) *plex.Plex {
+		if side == SideB {
+			return b
+		}
+		return a
+	})
+}
+
+// applyAll applies the actions of report on the client of their side and joins their errors.
+func applyAll(ctx context.Context, report *Report, client func(side Side) *plex.Plex) error {
+	var errs []error
+	for i := range report.Actions {
+		action := &report.Actions[i]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if action.Err = apply(ctx, client(action.Side), action); action.Err != nil {
+			errs = append(errs, fmt.Errorf("%s %s on %s: %w", action.Kind, action.Title, action.Side, action.Err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// item is a movie or an episode with the state Sync reconciles.
+type item struct {
+	kind         string
+	ratingKey    string
+	title        string
+	guid         string
+	imdb         string
+	tmdb         int
+	tvdb         int
+	watched      bool
+	lastViewedAt time.Time
+	offset       time.Duration
+	rating       float64
+}
+
+func items(libs library.Libraries) []*item {
+	var all []*item
+	for _, lib := range libs {
+		for _, m := range lib.Movies {
+			all = append(all, &item{
+				kind:         "movie",
+				ratingKey:    m.RatingKey,
+				title:        m.Title,
+				guid:         m.GUID,
+				imdb:         m.IMDB,
+				tmdb:         m.TMDB,
+				tvdb:         0,
+				watched:      m.Watched,
+				lastViewedAt: timeOrZero(m.LastViewedAt),
+				offset:       time.Duration(m.ViewOffset) * time.Millisecond,
+				rating:       m.UserRating,
+			})
+		}
+		for _, show := range lib.Shows {
+			for _, season := range show.Seasons {
+				for _, e := range season.Episodes {
+					all = append(all, &item{
+						kind:         "episode",
+						ratingKey:    e.RatingKey,
+						title:        show.Title + " - " + e.Title,
+						guid:         e.GUID,
+						imdb:         e.IMDB,
+						tmdb:         0,
+						tvdb:         e.TVDB,
+						watched:      e.Watched,
+						lastViewedAt: timeOrZero(e.LastViewedAt),
+						offset:       time.Duration(e.ViewOffset) * time.Millisecond,
+						rating:       e.UserRating,
+					})
+				}
+			}
+		}
+	}
+	return all
+}
+
+// itemIndex finds items by their external ids, ids shared by several items map to nil.
+type itemIndex map[string]*item
+
+func index(items []*item) itemIndex {
+	idx := make(itemIndex, len(items))
+	for _, it := range items {
+		for _, key := range it.keys() {
+			if m, ok := idx[key.id]; ok && m != it {
+				idx[key.id] = nil
+				continue
+			}
+			idx[key.id] = it
+		}
+	}
+	return idx
+}
+
+// match finds the item matching it by the first external id both know. The item is nil with the source set when
+// that id belongs to several items.
+func (idx itemIndex) match(it *item) (*item, string) {
+	for _, key := range it.keys() {
+		if m, ok := idx[key.id]; ok {
+			return m, key.source
+		}
+	}
+	return nil, ""
+}
+
+// matched is an item and the item of the other side it matches.
+type matched struct {
+	from, to *item
+	by       string
+}
+
+// matchAll matches the items to the ones in idx and counts them in report. An item of idx is only matched once,
+// items that would share one are counted as ambiguous like the ones matching several items.
+func matchAll(from []*item, idx itemIndex, report *Report) []matched {
+	var all []matched
+	uses := make(map[*item]int)
+	for _, it := range from {
+		m, by := idx.match(it)
+		switch {
+		case by == "":
+			report.Unmatched++
+		case m == nil:
+			report.Ambiguous++
+		default:
+			all = append(all, matched{from: it, to: m, by: by})
+			uses[m]++
+		}
+	}
+
+	unique := all[:0]
+	for _, m := range all {
+		if uses[m.to] > 1 {
+			report.Ambiguous++
+			continue
+		}
+		report.Matched++
+		unique = append(unique, m)
+	}
+	return unique
+}
+
+type itemKey struct {
+	source string
+	id     string
+}
+
+func (it *item) keys() []itemKey {
+	var keys []itemKey
+	if globalGUID(it.guid) {
+		keys = append(keys, itemKey{source: "guid", id: it.kind + "/guid/" + it.guid})
+	}
+	if it.imdb != "" {
+		keys = append(keys, itemKey{source: "imdb", id: it.kind + "/imdb/" + it.imdb})
+	}
+	if it.tmdb != 0 {
+		keys = append(keys, itemKey{source: "tmdb", id: it.kind + "/tmdb/" + strconv.Itoa(it.tmdb)})
+	}
+	if it.tvdb != 0 {
+		keys = append(keys, itemKey{source: "tvdb", id: it.kind + "/tvdb/" + strconv.Itoa(it.tvdb)})
+	}
+	return keys
+}
+
+// globalGUID tells whether guid comes from an agent that names the item the same on every server. Local guids, like
+// local:// or com.plexapp.agents.none://, are only unique on their own server.
+func globalGUID(guid string) bool {
+	for _, prefix := range []string{
+		"plex://",
+		"com.plexapp.agents.imdb://",
+		"com.plexapp.agents.themoviedb://",
+		"com.plexapp.agents.thetvdb://",
+	} {
+		if strings.HasPrefix(guid, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile returns the actions that make a and b agree.
+func reconcile(a, b *item, policy Policy) []Action {
+	winner, loser, loserSide := a, b, SideB
+	if wins(b, a, policy) {
+		winner, loser, loserSide = b, a, SideA
+	}
+
+	var actions []Action
+	if winner.watched != loser.watched {
+		kind := ActionUnwatched
+		if winner.watched {
+			kind = ActionWatched
+		}
+		actions = append(actions, newAction(loserSide, kind, loser))
+	}
+	// scrobbling clears the resume point, so only an unwatched winner has one to copy
+	if !winner.watched && winner.offset > 0 && winner.offset != loser.offset {
+		action := newAction(loserSide, ActionOffset, loser)
+		action.Offset = winner.offset
+		actions = append(actions, action)
+	}
+
+	switch {
+	case winner.rating == loser.rating:
+	case winner.rating > 0:
+		action := newAction(loserSide, ActionRating, loser)
+		action.Rating = winner.rating
+		actions = append(actions, action)
+	default:
+		// only the loser rated the item, there is no conflict to resolve
+		action := newAction(otherSide(loserSide), ActionRating, winner)
+		action.Rating = loser.rating
+		actions = append(actions, action)
+	}
+
+	return actions
+}
+
+// wins tells whether b wins over a.
+func wins(b, a *item, policy Policy) bool {
+	switch policy {
+	case PreferA:
+		return false
+	case PreferB:
+		return true
+	default:
+		if !b.lastViewedAt.Equal(a.lastViewedAt) {
+			return b.lastViewedAt.After(a.lastViewedAt)
+		}
+		return b.watched && !a.watched
+	}
+}
+
+func newAction(side Side, kind ActionKind, it *item) Action {
+	return Action{
+		Side:      side,
+		Kind:      kind,
+		RatingKey: it.ratingKey,
+		Title:     it.title,
+		MatchedBy: "",
+		Offset:    0,
+		Rating:    0,
+		Err:       nil,
+	}
+}
+
+func otherSide(s Side) Side {
+	if s == SideA {
+		return SideB
+	}
+	return SideA
+}
+
+func apply(ctx context.Context, client *plex.Plex, action *Action) error {
+	switch action.Kind {
+	case ActionWatched:
+		return client.Scrobble(action.RatingKey)
+	case ActionUnwatched:
+		return client.UnScrobble(action.RatingKey)
+	case ActionOffset:
+		return client.SetProgress(ctx, action.RatingKey, action.Offset, plex.PlaybackStopped)
+	case ActionRating:
+		return client.Rate(ctx, action.RatingKey, action.Rating)
+	default:
+		return fmt.Errorf("unknown action %q", action.Kind)
+	}
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,215 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	stdsync "sync"
+	"testing"
+	"time"
+
+	"github.com/kjbreil/go-plex/pkg/library"
+	"github.com/kjbreil/go-plex/pkg/plex"
+)
+
+// server records the watch state requests of a fake Plex server.
+type server struct {
+	mu       stdsync.Mutex
+	requests []string
+}
+
+func (s *server) ServeHTTP(_ http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	switch r.URL.Path {
+	case "/:/scrobble", "/:/unscrobble":
+		s.requests = append(s.requests, r.URL.Path+" "+q.Get("key"))
+	case "/:/progress":
+		s.requests = append(s.requests, r.URL.Path+" "+q.Get("key")+" "+q.Get("time"))
+	case "/:/rate":
+		s.requests = append(s.requests, r.URL.Path+" "+q.Get("key")+" "+q.Get("rating"))
+	}
+}
+
+func (s *server) got() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+func newClient(t *testing.T, libs library.Libraries) (*plex.Plex, *server) {
+	t.Helper()
+
+	s := new(server)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	client, err := plex.New(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	client.Libraries = libs
+
+	return client, s
+}
+
+func at(day int) *time.Time {
+	t := time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func fixtures() (library.Libraries, library.Libraries) {
+	a := library.Libraries{
+		{Movies: library.Movies{
+			// watched last on a, matched by guid
+			{RatingKey: "a1", Title: "Watched", GUID: "plex://movie/1", Watched: true, LastViewedAt: at(5)},
+			// in progress on b, matched by tmdb
+			{RatingKey: "a2", Title: "Started", GUID: "local://2", TMDB: 200},
+			// rated on both, b viewed last
+			{RatingKey: "a3", Title: "Rated", GUID: "plex://movie/3", UserRating: 6, LastViewedAt: at(1), Watched: true},
+			// only on a
+			{RatingKey: "a4", Title: "Missing", GUID: "plex://movie/4"},
+		}},
+		{Shows: library.Shows{{Title: "Show", Seasons: library.Seasons{1: {Episodes: library.Episodes{
+			1: {RatingKey: "a10", Title: "Pilot", TVDB: 1000},
+		}}}}}},
+	}
+	b := library.Libraries{
+		{Movies: library.Movies{
+			{RatingKey: "b1", Title: "Watched", GUID: "plex://movie/1"},
+			{RatingKey: "b2", Title: "Started", GUID: "local://other", TMDB: 200, LastViewedAt: at(3), ViewOffset: 60000},
+			{RatingKey: "b3", Title: "Rated", GUID: "plex://movie/3", UserRating: 9, LastViewedAt: at(2), Watched: true},
+		}},
+		{Shows: library.Shows{{Title: "Show", Seasons: library.Seasons{1: {Episodes: library.Episodes{
+			1: {RatingKey: "b10", Title: "Pilot", TVDB: 1000, UserRating: 8},
+		}}}}}},
+	}
+	return a, b
+}
+
+func TestSync(t *testing.T) {
+	libsA, libsB := fixtures()
+	a, serverA := newClient(t, libsA)
+	b, serverB := newClient(t, libsB)
+
+	report, err := Sync(context.Background(), a, b, Options{Policy: LatestViewed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 4 || report.Unmatched != 1 {
+		t.Fatalf("unexpected matches: %d matched, %d unmatched", report.Matched, report.Unmatched)
+	}
+
+	wantA := []string{"/:/progress a2 60000", "/:/rate a3 9", "/:/rate a10 8"}
+	if got := serverA.got(); !slices.Equal(got, wantA) {
+		t.Fatalf("unexpected requests on a:\n got %v\nwant %v", got, wantA)
+	}
+	wantB := []string{"/:/scrobble b1"}
+	if got := serverB.got(); !slices.Equal(got, wantB) {
+		t.Fatalf("unexpected requests on b:\n got %v\nwant %v", got, wantB)
+	}
+
+	for _, action := range report.Actions {
+		if action.Err != nil {
+			t.Errorf("action failed: %+v", action)
+		}
+		if action.RatingKey == "a2" && action.MatchedBy != "tmdb" {
+			t.Errorf("a2 matched by %q", action.MatchedBy)
+		}
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	libsA, libsB := fixtures()
+	a, serverA := newClient(t, libsA)
+	b, serverB := newClient(t, libsB)
+
+	report, err := Sync(context.Background(), a, b, Options{Policy: LatestViewed, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Actions) != 4 {
+		t.Fatalf("expected 4 actions, got %+v", report.Actions)
+	}
+	if len(serverA.got())+len(serverB.got()) != 0 {
+		t.Fatal("dry run sent requests")
+	}
+}
+
+func TestSyncPreferB(t *testing.T) {
+	libsA, libsB := fixtures()
+	a, _ := newClient(t, libsA)
+	b, _ := newClient(t, libsB)
+
+	report, err := Sync(context.Background(), a, b, Options{Policy: PreferB, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for _, action := range report.Actions {
+		if action.Side != SideA {
+			t.Fatalf("PreferB changed b: %+v", action)
+		}
+		kinds = append(kinds, action.RatingKey+" "+string(action.Kind))
+	}
+	want := []string{"a1 unwatched", "a2 offset", "a3 rating", "a10 rating"}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("unexpected actions:\n got %v\nwant %v", kinds, want)
+	}
+}
+
+func TestSyncLocalGUID(t *testing.T) {
+	// local guids are only unique on their own server, the same one on both is a different item
+	a, _ := newClient(t, library.Libraries{{Movies: library.Movies{
+		{RatingKey: "a1", Title: "Home Video", GUID: "local://7", Watched: true, LastViewedAt: at(5)},
+		{RatingKey: "a2", Title: "Unmatched", GUID: "com.plexapp.agents.none://7"},
+	}}})
+	b, _ := newClient(t, library.Libraries{{Movies: library.Movies{
+		{RatingKey: "b1", Title: "Other Video", GUID: "local://7"},
+		{RatingKey: "b2", Title: "Other Unmatched", GUID: "com.plexapp.agents.none://7"},
+	}}})
+
+	report, err := Sync(context.Background(), a, b, Options{Policy: LatestViewed, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 0 || report.Unmatched != 2 || len(report.Actions) != 0 {
+		t.Fatalf("local guids matched: %+v", report)
+	}
+}
+
+func TestSyncAmbiguous(t *testing.T) {
+	a, _ := newClient(t, library.Libraries{
+		{Movies: library.Movies{
+			// the same movie in two libraries of a
+			{RatingKey: "a1", Title: "Twice", GUID: "plex://movie/1", Watched: true, LastViewedAt: at(5)},
+			{RatingKey: "a3", Title: "Once", GUID: "plex://movie/3", Watched: true, LastViewedAt: at(5)},
+		}},
+		{Movies: library.Movies{
+			{RatingKey: "a2", Title: "Twice", GUID: "plex://movie/1"},
+		}},
+	})
+	b, _ := newClient(t, library.Libraries{
+		{Movies: library.Movies{
+			{RatingKey: "b1", Title: "Twice", GUID: "plex://movie/1", LastViewedAt: at(6)},
+			// the same movie in two libraries of b
+			{RatingKey: "b3", Title: "Once", GUID: "plex://movie/3"},
+		}},
+		{Movies: library.Movies{
+			{RatingKey: "b4", Title: "Once", GUID: "plex://movie/3"},
+		}},
+	})
+
+	report, err := Sync(context.Background(), a, b, Options{Policy: LatestViewed, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 0 || report.Ambiguous != 3 || len(report.Actions) != 0 {
+		t.Fatalf("ambiguous items matched: %+v", report)
+	}
+}